@@ -0,0 +1,16 @@
+// plugin-launcher is started by the converter-service in place of a plugin. It applies the resource limits it receives
+// from the service to its own process and then replaces itself with the plugin.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/epos-eu/converter-service/launcher"
+)
+
+func main() {
+	err := launcher.Main()
+	fmt.Fprintf(os.Stderr, "plugin-launcher: %v\n", err)
+	os.Exit(127)
+}
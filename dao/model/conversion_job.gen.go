@@ -0,0 +1,73 @@
+package model
+
+import (
+	"time"
+)
+
+const TableNameConversionJob = "converter_catalogue.conversion_job"
+
+// JobState is the state of a conversion job
+type JobState string
+
+const (
+	// the job waits for a free slot
+	JobQueued JobState = "queued"
+	// the conversion is running
+	JobRunning JobState = "running"
+	// the conversion succeeded, its result can be retrieved
+	JobSucceeded JobState = "succeeded"
+	// the conversion failed, the error of the job says why
+	JobFailed JobState = "failed"
+	// the job was cancelled before it finished
+	JobCancelled JobState = "cancelled"
+)
+
+// Finished returns whether the job is over
+func (s JobState) Finished() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// ConversionJob mapped from table <conversion_job>
+type ConversionJob struct {
+	// the id of the job (generated when the job is created)
+	ID string `gorm:"column:id;primaryKey" json:"id"`
+	// the state of the job
+	State JobState `gorm:"column:state;not null" json:"state"`
+	// the instanceId of the distribution of the conversion
+	DistributionID string `gorm:"column:distribution_id;not null" json:"distribution_id"`
+	// the id of the plugin of the conversion, empty if it is selected from the relations of the distribution
+	PluginID string `gorm:"column:plugin_id;not null" json:"plugin_id,omitempty"`
+	// the id of the pipeline of the conversion, if any
+	PipelineID string `gorm:"column:pipeline_id;not null" json:"pipeline_id,omitempty"`
+	// why the job failed
+	Error *JobError `gorm:"column:error;serializer:json" json:"error,omitempty"`
+	// the output of the conversion, given to FinishJob which stores it in a large object
+	Result []byte `gorm:"-" json:"-"`
+	// the large object holding the output of the conversion, once it succeeded
+	ResultOID *uint32 `gorm:"column:result_oid" json:"-"`
+	// the size of the output of the conversion in bytes
+	ResultSize int64 `gorm:"column:result_size;not null;default:0" json:"result_size,omitempty"`
+	// the hostname of the replica running the job
+	Owner string `gorm:"column:owner;not null" json:"owner"`
+	// when the job was created
+	CreatedAt time.Time `gorm:"column:created_at;not null" json:"created_at"`
+	// when the conversion started
+	StartedAt *time.Time `gorm:"column:started_at" json:"started_at,omitempty"`
+	// when the job finished
+	FinishedAt *time.Time `gorm:"column:finished_at" json:"finished_at,omitempty"`
+	// when the job and its result are deleted
+	ExpiresAt *time.Time `gorm:"column:expires_at" json:"expires_at,omitempty"`
+}
+
+// JobError is the error of a failed job, as in the error replies of the converter-service
+type JobError struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	PluginID string `json:"pluginId,omitempty"`
+	Stderr   string `json:"stderr,omitempty"`
+}
+
+// TableName ConversionJob's table name
+func (*ConversionJob) TableName() string {
+	return TableNameConversionJob
+}
@@ -0,0 +1,55 @@
+package model
+
+import (
+	"time"
+)
+
+const TableNameExecution = "converter_catalogue.executions"
+
+// ExecutionOutcome is how an execution of a plugin ended
+type ExecutionOutcome string
+
+const (
+	// the plugin wrote its output
+	ExecutionSucceeded ExecutionOutcome = "succeeded"
+	// the plugin failed, the error code of the execution says why
+	ExecutionFailed ExecutionOutcome = "failed"
+)
+
+// Execution mapped from table <executions>
+type Execution struct {
+	// the id of the execution (generated when the execution is recorded)
+	ID string `gorm:"column:id;primaryKey" json:"id"`
+	// the correlation id of the message, or of the HTTP request, of the conversion
+	CorrelationID string `gorm:"column:correlation_id;not null" json:"correlation_id"`
+	// the instanceId of the distribution of the conversion
+	DistributionID string `gorm:"column:distribution_id;not null" json:"distribution_id"`
+	// the id of the plugin, and the branch or tag it was installed from
+	PluginID      string `gorm:"column:plugin_id;not null" json:"plugin_id"`
+	PluginVersion string `gorm:"column:plugin_version;not null" json:"plugin_version"`
+	// the id of the pipeline the plugin was run by, if any
+	PipelineID string `gorm:"column:pipeline_id;not null" json:"pipeline_id,omitempty"`
+	// the number of the step of the pipeline, starting from 1
+	PipelineStep int `gorm:"column:pipeline_step;not null" json:"pipeline_step,omitempty"`
+	// the runtime of the plugin
+	Runtime string `gorm:"column:runtime;not null" json:"runtime"`
+	// when the plugin started and finished
+	StartedAt  time.Time `gorm:"column:started_at;not null" json:"started_at"`
+	FinishedAt time.Time `gorm:"column:finished_at;not null" json:"finished_at"`
+	DurationMs int64     `gorm:"column:duration_ms;not null" json:"duration_ms"`
+	// either 'succeeded' or 'failed'
+	Outcome ExecutionOutcome `gorm:"column:outcome;not null" json:"outcome"`
+	// why the execution failed, the code is one of the error codes of the error replies
+	ErrorCode    string `gorm:"column:error_code;not null" json:"error_code,omitempty"`
+	ErrorMessage string `gorm:"column:error_message;not null" json:"error_message,omitempty"`
+	// the size in bytes of the payload given to the plugin and of the output it wrote
+	PayloadSize int64 `gorm:"column:payload_size;not null" json:"payload_size"`
+	OutputSize  int64 `gorm:"column:output_size;not null" json:"output_size"`
+	// the tail of the stderr of the plugin (of the worker for the plugins using the worker protocol)
+	Stderr string `gorm:"column:stderr;not null" json:"stderr,omitempty"`
+}
+
+// TableName Execution's table name
+func (*Execution) TableName() string {
+	return TableNameExecution
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"mime"
+	"strings"
+)
+
+// MediaType returns the lowercase media type of a format, without its parameters (e.g. charset). Formats that are not
+// valid content types are compared on what is before their parameters.
+func MediaType(format string) string {
+	mediaType, _, err := mime.ParseMediaType(format)
+	if err != nil {
+		mediaType, _, _ = strings.Cut(format, ";")
+		mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	}
+	return mediaType
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// NullableID is an id that is stored as NULL in the database when it is empty
+type NullableID string
+
+// Value implements the driver.Valuer interface.
+func (id NullableID) Value() (driver.Value, error) {
+	if id == "" {
+		return nil, nil
+	}
+	return string(id), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (id *NullableID) Scan(value any) error {
+	switch v := value.(type) {
+	case nil:
+		*id = ""
+	case string:
+		*id = NullableID(v)
+	case []byte:
+		*id = NullableID(v)
+	case [16]byte:
+		*id = NullableID(uuid.UUID(v).String())
+	default:
+		return fmt.Errorf("can't scan %T into a NullableID", value)
+	}
+	return nil
+}
+
+// String implements the Stringer interface.
+func (id NullableID) String() string {
+	return string(id)
+}
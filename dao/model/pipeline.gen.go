@@ -0,0 +1,77 @@
+package model
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+const TableNamePipeline = "converter_catalogue.pipeline"
+
+// Pipeline mapped from table <pipeline>
+type Pipeline struct {
+	// the id of the pipeline (generated when the pipeline is created)
+	ID string `gorm:"column:id;primaryKey" json:"id"`
+	// the name of the pipeline
+	Name string `gorm:"column:name;not null" json:"name"`
+	// a description of the pipeline
+	Description string `gorm:"column:description;not null" json:"description"`
+	// the plugins run one after the other, each one on the output of the previous one
+	Steps []PipelineStep `gorm:"column:steps;serializer:json;not null" json:"steps"`
+	// the maximum execution time of the whole pipeline in seconds (0 to use the service default)
+	Timeout int `gorm:"column:timeout;not null;default:0" json:"timeout"`
+}
+
+// PipelineStep is a conversion done by a plugin in a pipeline
+type PipelineStep struct {
+	// the id of the plugin (from the plugin table)
+	PluginID string `json:"plugin_id"`
+	// the file format expected by the plugin for the input
+	InputFormat string `json:"input_format"`
+	// the file format of the output of the plugin
+	OutputFormat string `json:"output_format"`
+}
+
+// TableName Pipeline's table name
+func (*Pipeline) TableName() string {
+	return TableNamePipeline
+}
+
+func (p *Pipeline) Validate() error {
+	if p.ID == "" || uuid.Validate(p.ID) != nil {
+		return fmt.Errorf("invalid Id in pipeline: %+v", p)
+	}
+	if p.Name == "" {
+		return fmt.Errorf("invalid Name in pipeline: %+v", p)
+	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("invalid Timeout in pipeline: %d must not be negative", p.Timeout)
+	}
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("invalid Steps in pipeline: a pipeline needs at least one step")
+	}
+	for i, step := range p.Steps {
+		if step.PluginID == "" || uuid.Validate(step.PluginID) != nil {
+			return fmt.Errorf("invalid PluginID in step %d of pipeline: %+v", i+1, step)
+		}
+		// running a plugin again would convert back and forth
+		for j := range i {
+			if p.Steps[j].PluginID == step.PluginID {
+				return fmt.Errorf("invalid Steps in pipeline: plugin %s is used by both step %d and step %d", step.PluginID, j+1, i+1)
+			}
+		}
+		if step.InputFormat == "" {
+			return fmt.Errorf("invalid InputFormat in step %d of pipeline: %+v", i+1, step)
+		}
+		if step.OutputFormat == "" {
+			return fmt.Errorf("invalid OutputFormat in step %d of pipeline: %+v", i+1, step)
+		}
+		// the output of each step is the input of the next one
+		if i > 0 && MediaType(p.Steps[i-1].OutputFormat) != MediaType(step.InputFormat) {
+			return fmt.Errorf("invalid Steps in pipeline: the output format %s of step %d does not match the input format %s of step %d",
+				p.Steps[i-1].OutputFormat, i, step.InputFormat, i+1)
+		}
+	}
+
+	return nil
+}
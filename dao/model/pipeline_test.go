@@ -0,0 +1,106 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPipelineValidate(t *testing.T) {
+	const (
+		id      = "7a3c1a50-0f6e-4d8c-9a39-6b1bd3f0d4a1"
+		plugin1 = "0b4a2f44-5d0b-4bb7-9cf6-5e2f3ed3a8c1"
+		plugin2 = "f1f5b1c6-2a44-4a4e-8d5e-0b7f2c3d9e10"
+	)
+	step := func(pluginID, input, output string) PipelineStep {
+		return PipelineStep{PluginID: pluginID, InputFormat: input, OutputFormat: output}
+	}
+	tests := []struct {
+		name     string
+		pipeline Pipeline
+		// part of the error, empty if the pipeline is valid
+		want string
+	}{
+		{
+			name: "valid",
+			pipeline: Pipeline{ID: id, Name: "p", Steps: []PipelineStep{
+				step(plugin1, "application/xml", "application/json"),
+				step(plugin2, "application/json", "application/geo+json"),
+			}},
+		},
+		{
+			name: "formats matching without their parameters and case",
+			pipeline: Pipeline{ID: id, Name: "p", Steps: []PipelineStep{
+				step(plugin1, "application/xml", "Application/JSON; charset=utf-8"),
+				step(plugin2, "application/json", "application/geo+json"),
+			}},
+		},
+		{
+			name:     "invalid id",
+			pipeline: Pipeline{ID: "pipeline", Name: "p", Steps: []PipelineStep{step(plugin1, "a/b", "c/d")}},
+			want:     "invalid Id",
+		},
+		{
+			name:     "no name",
+			pipeline: Pipeline{ID: id, Steps: []PipelineStep{step(plugin1, "a/b", "c/d")}},
+			want:     "invalid Name",
+		},
+		{
+			name:     "negative timeout",
+			pipeline: Pipeline{ID: id, Name: "p", Timeout: -1, Steps: []PipelineStep{step(plugin1, "a/b", "c/d")}},
+			want:     "invalid Timeout",
+		},
+		{
+			name:     "no steps",
+			pipeline: Pipeline{ID: id, Name: "p"},
+			want:     "at least one step",
+		},
+		{
+			name:     "missing plugin",
+			pipeline: Pipeline{ID: id, Name: "p", Steps: []PipelineStep{step("", "a/b", "c/d")}},
+			want:     "invalid PluginID in step 1",
+		},
+		{
+			name:     "invalid plugin",
+			pipeline: Pipeline{ID: id, Name: "p", Steps: []PipelineStep{step(plugin1, "a/b", "c/d"), step("plugin", "c/d", "e/f")}},
+			want:     "invalid PluginID in step 2",
+		},
+		{
+			name: "duplicate plugin",
+			pipeline: Pipeline{ID: id, Name: "p", Steps: []PipelineStep{
+				step(plugin1, "a/b", "c/d"),
+				step(plugin2, "c/d", "a/b"),
+				step(plugin1, "a/b", "c/d"),
+			}},
+			want: "used by both step 1 and step 3",
+		},
+		{
+			name:     "missing input format",
+			pipeline: Pipeline{ID: id, Name: "p", Steps: []PipelineStep{step(plugin1, "", "c/d")}},
+			want:     "invalid InputFormat",
+		},
+		{
+			name:     "missing output format",
+			pipeline: Pipeline{ID: id, Name: "p", Steps: []PipelineStep{step(plugin1, "a/b", "")}},
+			want:     "invalid OutputFormat",
+		},
+		{
+			name: "adjacent formats not matching",
+			pipeline: Pipeline{ID: id, Name: "p", Steps: []PipelineStep{
+				step(plugin1, "application/xml", "application/json"),
+				step(plugin2, "text/csv", "application/geo+json"),
+			}},
+			want: "the output format application/json of step 1 does not match the input format text/csv of step 2",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.pipeline.Validate()
+			switch {
+			case test.want == "" && err != nil:
+				t.Errorf("got %v, want no error", err)
+			case test.want != "" && (err == nil || !strings.Contains(err.Error(), test.want)):
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
@@ -11,8 +11,8 @@ const TableNamePlugin = "converter_catalogue.plugin"
 // ENUM(branch, tag)
 type VersionType string
 
-// ENUM(binary, java, python)
-type SupportedRuntimes string
+// ENUM(oneshot, worker)
+type Protocol string
 
 // Plugin mapped from table <plugin>
 type Plugin struct {
@@ -38,6 +38,14 @@ type Plugin struct {
 	Installed bool `gorm:"column:installed;not null" json:"installed"`
 	// if the plugin is enabled aka if it can be used
 	Enabled bool `gorm:"column:enabled;not null" json:"enabled"`
+	// the maximum execution time in seconds (0 to use the service default)
+	Timeout int `gorm:"column:timeout;not null;default:0" json:"timeout"`
+	// the resource limits of the plugin process (unset limits fall back to the defaults of the runtime)
+	Limits ResourceLimits `gorm:"column:limits;serializer:json;not null;default:'{}'" json:"limits"`
+	// the restrictions of the sandbox the plugin is allowed to relax
+	Sandbox SandboxPolicy `gorm:"column:sandbox;serializer:json;not null;default:'{}'" json:"sandbox"`
+	// either 'oneshot' (a new process for each conversion) or 'worker' (a long running process receiving jobs)
+	Protocol Protocol `gorm:"column:protocol;not null;default:oneshot" json:"protocol"`
 }
 
 // TableName Plugin's table name
@@ -74,6 +82,18 @@ func (p *Plugin) Validate() error {
 	if p.Executable == "" {
 		return fmt.Errorf("invalid Executable in plugin: %+v", p)
 	}
+	if p.Timeout < 0 {
+		return fmt.Errorf("invalid Timeout in plugin: %d must not be negative", p.Timeout)
+	}
+	if err := p.Limits.Validate(); err != nil {
+		return fmt.Errorf("invalid Limits in plugin: %w", err)
+	}
+	if p.Protocol != "" && !p.Protocol.IsValid() {
+		return fmt.Errorf("invalid Protocol in plugin: %s is not in any of %+v", p.Protocol, ProtocolValues())
+	}
+	if err := p.Sandbox.Validate(); err != nil {
+		return fmt.Errorf("invalid Sandbox in plugin: %w", err)
+	}
 
 	return nil
 }
@@ -12,49 +12,45 @@ import (
 )
 
 const (
-	// SupportedRuntimesBinary is a SupportedRuntimes of type binary.
-	SupportedRuntimesBinary SupportedRuntimes = "binary"
-	// SupportedRuntimesJava is a SupportedRuntimes of type java.
-	SupportedRuntimesJava SupportedRuntimes = "java"
-	// SupportedRuntimesPython is a SupportedRuntimes of type python.
-	SupportedRuntimesPython SupportedRuntimes = "python"
+	// ProtocolOneshot is a Protocol of type oneshot.
+	ProtocolOneshot Protocol = "oneshot"
+	// ProtocolWorker is a Protocol of type worker.
+	ProtocolWorker Protocol = "worker"
 )
 
-var ErrInvalidSupportedRuntimes = errors.New("not a valid SupportedRuntimes")
+var ErrInvalidProtocol = errors.New("not a valid Protocol")
 
-// SupportedRuntimesValues returns a list of the values for SupportedRuntimes
-func SupportedRuntimesValues() []SupportedRuntimes {
-	return []SupportedRuntimes{
-		SupportedRuntimesBinary,
-		SupportedRuntimesJava,
-		SupportedRuntimesPython,
+// ProtocolValues returns a list of the values for Protocol
+func ProtocolValues() []Protocol {
+	return []Protocol{
+		ProtocolOneshot,
+		ProtocolWorker,
 	}
 }
 
 // String implements the Stringer interface.
-func (x SupportedRuntimes) String() string {
+func (x Protocol) String() string {
 	return string(x)
 }
 
 // IsValid provides a quick way to determine if the typed value is
 // part of the allowed enumerated values
-func (x SupportedRuntimes) IsValid() bool {
-	_, err := ParseSupportedRuntimes(string(x))
+func (x Protocol) IsValid() bool {
+	_, err := ParseProtocol(string(x))
 	return err == nil
 }
 
-var _SupportedRuntimesValue = map[string]SupportedRuntimes{
-	"binary": SupportedRuntimesBinary,
-	"java":   SupportedRuntimesJava,
-	"python": SupportedRuntimesPython,
+var _ProtocolValue = map[string]Protocol{
+	"oneshot": ProtocolOneshot,
+	"worker":  ProtocolWorker,
 }
 
-// ParseSupportedRuntimes attempts to convert a string to a SupportedRuntimes.
-func ParseSupportedRuntimes(name string) (SupportedRuntimes, error) {
-	if x, ok := _SupportedRuntimesValue[name]; ok {
+// ParseProtocol attempts to convert a string to a Protocol.
+func ParseProtocol(name string) (Protocol, error) {
+	if x, ok := _ProtocolValue[name]; ok {
 		return x, nil
 	}
-	return SupportedRuntimes(""), fmt.Errorf("%s is %w", name, ErrInvalidSupportedRuntimes)
+	return Protocol(""), fmt.Errorf("%s is %w", name, ErrInvalidProtocol)
 }
 
 const (
@@ -0,0 +1,84 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const TableNamePluginFixture = "converter_catalogue.plugin_fixture"
+
+// CompareMode is how the output of a plugin is compared to the expected output of a fixture
+type CompareMode string
+
+const (
+	// the output must be the expected output, byte for byte apart from the surrounding whitespace
+	CompareExact CompareMode = "exact"
+	// the output must have the structure and the values of the expected output, within the tolerance
+	CompareJSON CompareMode = "json"
+)
+
+// PluginFixture mapped from table <plugin_fixture>
+type PluginFixture struct {
+	// the id of the fixture (generated when the fixture is created)
+	ID string `gorm:"column:id;primaryKey" json:"id"`
+	// the id of the plugin (from the plugin table)
+	PluginID string `gorm:"column:plugin_id;not null" json:"plugin_id"`
+	// the name of the fixture
+	Name string `gorm:"column:name;not null" json:"name"`
+	// the payload given to the plugin
+	Input string `gorm:"column:input;not null" json:"input"`
+	// the output the plugin must write for the payload
+	Expected string `gorm:"column:expected;not null" json:"expected"`
+	// the parameters given to the plugin with the payload
+	DistributionID      string `gorm:"column:distribution_id;not null;default:''" json:"distribution_id"`
+	RequestContentType  string `gorm:"column:request_content_type;not null;default:''" json:"request_content_type"`
+	ResponseContentType string `gorm:"column:response_content_type;not null;default:''" json:"response_content_type"`
+	// either 'exact' or 'json'
+	Compare CompareMode `gorm:"column:compare;not null;default:json" json:"compare"`
+	// the maximum absolute difference between two numbers for them to be equal (json only)
+	Tolerance float64 `gorm:"column:tolerance;not null;default:0" json:"tolerance"`
+	// JSON pointers (e.g. /metadata/generatedAt) of the values that are not compared (json only)
+	IgnorePaths []string `gorm:"column:ignore_paths;serializer:json;not null;default:'[]'" json:"ignore_paths"`
+}
+
+// TableName PluginFixture's table name
+func (*PluginFixture) TableName() string {
+	return TableNamePluginFixture
+}
+
+func (f *PluginFixture) Validate() error {
+	if f.ID == "" || uuid.Validate(f.ID) != nil {
+		return fmt.Errorf("invalid Id in fixture: %+v", f)
+	}
+	if f.PluginID == "" || uuid.Validate(f.PluginID) != nil {
+		return fmt.Errorf("invalid PluginID in fixture: %+v", f)
+	}
+	if f.Name == "" {
+		return fmt.Errorf("invalid Name in fixture: %+v", f)
+	}
+	if f.Input == "" {
+		return fmt.Errorf("invalid Input in fixture: the input is empty")
+	}
+	switch f.Compare {
+	case CompareExact:
+	case CompareJSON:
+		if !json.Valid([]byte(f.Expected)) {
+			return fmt.Errorf("invalid Expected in fixture: the expected output is not valid JSON")
+		}
+	default:
+		return fmt.Errorf("invalid Compare in fixture: %s is not in any of %+v", f.Compare, []CompareMode{CompareExact, CompareJSON})
+	}
+	if f.Tolerance < 0 {
+		return fmt.Errorf("invalid Tolerance in fixture: %g must not be negative", f.Tolerance)
+	}
+	for _, path := range f.IgnorePaths {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid IgnorePaths in fixture: %s is not a JSON pointer", path)
+		}
+	}
+
+	return nil
+}
@@ -12,8 +12,10 @@ const TableNamePluginRelation = "converter_catalogue.plugin_relations"
 type PluginRelation struct {
 	// the id of the relation (generated when the relation is created)
 	ID string `gorm:"column:id;primaryKey" json:"id"`
-	// the id of the plugin (from the plugin table)
-	PluginID string `gorm:"column:plugin_id;not null" json:"plugin_id"`
+	// the id of the plugin (from the plugin table), empty if the relation points at a pipeline
+	PluginID NullableID `gorm:"column:plugin_id" json:"plugin_id"`
+	// the id of the pipeline (from the pipeline table), empty if the relation points at a plugin
+	PipelineID NullableID `gorm:"column:pipeline_id" json:"pipeline_id,omitempty"`
 	// the instanceId of the distribution
 	RelationID string `gorm:"column:relation_id;not null" json:"relation_id"`
 	// the file format expected by the plugin for the input
@@ -39,9 +41,16 @@ func (r *PluginRelation) Validate() error {
 		return fmt.Errorf("invalid OutputFormat in relation: %+v", r)
 	}
 
-	if r.PluginID == "" || uuid.Validate(r.PluginID) != nil {
+	// a relation points at either a plugin or a pipeline
+	if (r.PluginID == "") == (r.PipelineID == "") {
+		return fmt.Errorf("invalid relation: exactly one of PluginID and PipelineID must be set: %+v", r)
+	}
+	if r.PluginID != "" && uuid.Validate(r.PluginID.String()) != nil {
 		return fmt.Errorf("invalid PluginID in relation: %+v", r)
 	}
+	if r.PipelineID != "" && uuid.Validate(r.PipelineID.String()) != nil {
+		return fmt.Errorf("invalid PipelineID in relation: %+v", r)
+	}
 	// TODO: check that the plugin exists
 	// if _, err := connection.GetPluginById(r.PluginID); err != nil {
 	// 	return fmt.Errorf("plugin with ID: %s does not exist", r.PluginID)
@@ -0,0 +1,44 @@
+package model
+
+import "fmt"
+
+// ResourceLimits are the limits applied to the process of a plugin. A zero value means no limit.
+type ResourceLimits struct {
+	// maximum memory in MiB (resident memory when a cgroup is available, address space otherwise)
+	MemoryMB int `json:"memory_mb,omitempty"`
+	// maximum CPU time in seconds
+	CPUSeconds int `json:"cpu_seconds,omitempty"`
+	// maximum size in MiB of any file written by the plugin
+	FileSizeMB int `json:"file_size_mb,omitempty"`
+	// maximum number of open file descriptors
+	OpenFiles int `json:"open_files,omitempty"`
+}
+
+// IsZero reports whether no limit is set
+func (l ResourceLimits) IsZero() bool {
+	return l == ResourceLimits{}
+}
+
+// Or returns l with every unset limit taken from defaults
+func (l ResourceLimits) Or(defaults ResourceLimits) ResourceLimits {
+	if l.MemoryMB == 0 {
+		l.MemoryMB = defaults.MemoryMB
+	}
+	if l.CPUSeconds == 0 {
+		l.CPUSeconds = defaults.CPUSeconds
+	}
+	if l.FileSizeMB == 0 {
+		l.FileSizeMB = defaults.FileSizeMB
+	}
+	if l.OpenFiles == 0 {
+		l.OpenFiles = defaults.OpenFiles
+	}
+	return l
+}
+
+func (l ResourceLimits) Validate() error {
+	if l.MemoryMB < 0 || l.CPUSeconds < 0 || l.FileSizeMB < 0 || l.OpenFiles < 0 {
+		return fmt.Errorf("invalid resource limits: %+v, limits must not be negative", l)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// SupportedRuntimes is the name of a runtime of the converter. The valid values are not fixed: they are the runtimes
+// registered by the handler, the builtin ones and the ones defined in its runtime configuration.
+type SupportedRuntimes string
+
+const (
+	// SupportedRuntimesBinary is a builtin SupportedRuntimes running an executable.
+	SupportedRuntimesBinary SupportedRuntimes = "binary"
+	// SupportedRuntimesGo is a builtin SupportedRuntimes running an executable built from go.
+	SupportedRuntimesGo SupportedRuntimes = "go"
+	// SupportedRuntimesJava is a builtin SupportedRuntimes running a jar.
+	SupportedRuntimesJava SupportedRuntimes = "java"
+	// SupportedRuntimesPython is a builtin SupportedRuntimes running a python script in the venv of the plugin.
+	SupportedRuntimesPython SupportedRuntimes = "python"
+)
+
+var ErrInvalidSupportedRuntimes = errors.New("not a valid SupportedRuntimes")
+
+var (
+	runtimesMu sync.RWMutex
+	runtimes   = map[SupportedRuntimes]struct{}{}
+)
+
+// RegisterRuntime makes name a valid SupportedRuntimes
+func RegisterRuntime(name SupportedRuntimes) {
+	runtimesMu.Lock()
+	defer runtimesMu.Unlock()
+	runtimes[name] = struct{}{}
+}
+
+// SupportedRuntimesValues returns a sorted list of the registered SupportedRuntimes
+func SupportedRuntimesValues() []SupportedRuntimes {
+	runtimesMu.RLock()
+	defer runtimesMu.RUnlock()
+	values := make([]SupportedRuntimes, 0, len(runtimes))
+	for name := range runtimes {
+		values = append(values, name)
+	}
+	slices.Sort(values)
+	return values
+}
+
+// String implements the Stringer interface.
+func (x SupportedRuntimes) String() string {
+	return string(x)
+}
+
+// IsValid returns whether the runtime is registered
+func (x SupportedRuntimes) IsValid() bool {
+	_, err := ParseSupportedRuntimes(string(x))
+	return err == nil
+}
+
+// ParseSupportedRuntimes attempts to convert a string to a registered SupportedRuntimes.
+func ParseSupportedRuntimes(name string) (SupportedRuntimes, error) {
+	runtimesMu.RLock()
+	defer runtimesMu.RUnlock()
+	if _, ok := runtimes[SupportedRuntimes(name)]; ok {
+		return SupportedRuntimes(name), nil
+	}
+	return SupportedRuntimes(""), fmt.Errorf("%s is %w", name, ErrInvalidSupportedRuntimes)
+}
@@ -0,0 +1,28 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// SandboxPolicy lists the restrictions of the sandbox that a plugin is allowed to relax. The zero value keeps every
+// restriction.
+type SandboxPolicy struct {
+	// keep the network of the service instead of getting a private network namespace
+	AllowNetwork bool `json:"allow_network,omitempty"`
+	// names of the environment variables of the service passed to the plugin
+	AllowEnv []string `json:"allow_env,omitempty"`
+	// mount the plugin directory read-write
+	WritablePluginDir bool `json:"writable_plugin_dir,omitempty"`
+	// share /tmp with the service instead of getting a private one
+	SharedTmp bool `json:"shared_tmp,omitempty"`
+}
+
+func (p SandboxPolicy) Validate() error {
+	for _, name := range p.AllowEnv {
+		if name == "" || strings.Contains(name, "=") {
+			return fmt.Errorf("invalid environment variable name in sandbox policy: %q", name)
+		}
+	}
+	return nil
+}
@@ -25,6 +25,18 @@ func Get() *gorm.DB {
 	return converterDB
 }
 
+// Close closes the connections to the database
+func Close() error {
+	if converterDB == nil {
+		return nil
+	}
+	sqlDB, err := converterDB.DB()
+	if err != nil {
+		return fmt.Errorf("error getting the database connection pool: %w", err)
+	}
+	return sqlDB.Close()
+}
+
 func Init() error {
 	envVars := []string{"POSTGRESQL_CONNECTION_STRING", "CONVERTER_CATALOGUE_CONNECTION_STRING"}
 	for _, envVar := range envVars {
@@ -71,6 +83,12 @@ func Init() error {
 			}
 
 			log.Info("successfully connected to database", "env_var", envVar)
+			if err := registerMetrics(db); err != nil {
+				return err
+			}
+			if err := migrate(db); err != nil {
+				return err
+			}
 			converterDB = db
 			return nil
 		}
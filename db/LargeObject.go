@@ -0,0 +1,44 @@
+package db
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+)
+
+// the size of the chunks of the job results read at once
+const jobResultChunkSize = 1024 * 1024
+
+// JobResult returns a reader of the result of a job, the large object oid of size bytes. The result is read from the
+// database a chunk at a time, as the reader is read.
+func JobResult(ctx context.Context, oid uint32, size int64) io.Reader {
+	return bufio.NewReaderSize(&largeObjectReader{ctx: ctx, oid: oid, size: size}, jobResultChunkSize)
+}
+
+// largeObjectReader reads a large object with lo_get, so that it needs no transaction kept open while it is read
+type largeObjectReader struct {
+	ctx    context.Context
+	oid    uint32
+	offset int64
+	size   int64
+}
+
+func (r *largeObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	length := int(min(int64(len(p)), r.size-r.offset, jobResultChunkSize))
+
+	var chunk []byte
+	err := Get().WithContext(r.ctx).Raw("SELECT lo_get(?, ?, ?)", r.oid, r.offset, length).Row().Scan(&chunk)
+	if err != nil {
+		return 0, fmt.Errorf("error reading the large object %d: %w", r.oid, err)
+	}
+	if len(chunk) == 0 {
+		return 0, io.ErrUnexpectedEOF
+	}
+	n := copy(p, chunk)
+	r.offset += int64(n)
+	return n, nil
+}
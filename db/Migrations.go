@@ -0,0 +1,100 @@
+package db
+
+import (
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// migrations are the schema changes owned by the converter-service on top of the converter_catalogue schema.
+// Every statement must be idempotent, they are all run at every startup in order.
+var migrations = []string{
+	// per-plugin execution timeout in seconds (0 means use the service default)
+	`ALTER TABLE converter_catalogue.plugin ADD COLUMN IF NOT EXISTS timeout integer NOT NULL DEFAULT 0`,
+	// per-plugin resource limits
+	`ALTER TABLE converter_catalogue.plugin ADD COLUMN IF NOT EXISTS limits jsonb NOT NULL DEFAULT '{}'`,
+	// per-plugin relaxations of the sandbox
+	`ALTER TABLE converter_catalogue.plugin ADD COLUMN IF NOT EXISTS sandbox jsonb NOT NULL DEFAULT '{}'`,
+	// execution protocol of the plugin (oneshot or worker)
+	`ALTER TABLE converter_catalogue.plugin ADD COLUMN IF NOT EXISTS protocol text NOT NULL DEFAULT 'oneshot'`,
+	// pipelines of plugins, and relations pointing at a pipeline instead of a plugin
+	`CREATE TABLE IF NOT EXISTS converter_catalogue.pipeline (
+		id text PRIMARY KEY,
+		name text NOT NULL,
+		description text NOT NULL DEFAULT '',
+		steps jsonb NOT NULL DEFAULT '[]'
+	)`,
+	`ALTER TABLE converter_catalogue.plugin_relations ADD COLUMN IF NOT EXISTS pipeline_id text REFERENCES converter_catalogue.pipeline (id)`,
+	`ALTER TABLE converter_catalogue.plugin_relations ALTER COLUMN plugin_id DROP NOT NULL`,
+	// per-pipeline execution timeout in seconds (0 means use the service default)
+	`ALTER TABLE converter_catalogue.pipeline ADD COLUMN IF NOT EXISTS timeout integer NOT NULL DEFAULT 0`,
+	// asynchronous conversion jobs, deleted once they expire
+	`CREATE TABLE IF NOT EXISTS converter_catalogue.conversion_job (
+		id text PRIMARY KEY,
+		state text NOT NULL,
+		distribution_id text NOT NULL,
+		plugin_id text NOT NULL DEFAULT '',
+		pipeline_id text NOT NULL DEFAULT '',
+		error jsonb,
+		-- the result is a large object, so that it is streamed rather than loaded whole
+		result_oid oid,
+		result_size bigint NOT NULL DEFAULT 0,
+		owner text NOT NULL,
+		created_at timestamptz NOT NULL,
+		started_at timestamptz,
+		finished_at timestamptz,
+		expires_at timestamptz
+	)`,
+	`CREATE INDEX IF NOT EXISTS conversion_job_expires_at_idx ON converter_catalogue.conversion_job (expires_at)`,
+	// golden-file fixtures of the plugins, deleted with their plugin
+	`CREATE TABLE IF NOT EXISTS converter_catalogue.plugin_fixture (
+		id text PRIMARY KEY,
+		plugin_id text NOT NULL REFERENCES converter_catalogue.plugin (id) ON DELETE CASCADE,
+		name text NOT NULL,
+		input text NOT NULL,
+		expected text NOT NULL,
+		distribution_id text NOT NULL DEFAULT '',
+		request_content_type text NOT NULL DEFAULT '',
+		response_content_type text NOT NULL DEFAULT '',
+		compare text NOT NULL DEFAULT 'json',
+		tolerance double precision NOT NULL DEFAULT 0,
+		ignore_paths jsonb NOT NULL DEFAULT '[]'
+	)`,
+	`CREATE INDEX IF NOT EXISTS plugin_fixture_plugin_id_idx ON converter_catalogue.plugin_fixture (plugin_id)`,
+	// history of the plugin executions, purged after the retention period
+	`CREATE TABLE IF NOT EXISTS converter_catalogue.executions (
+		id text PRIMARY KEY,
+		correlation_id text NOT NULL DEFAULT '',
+		distribution_id text NOT NULL DEFAULT '',
+		plugin_id text NOT NULL,
+		plugin_version text NOT NULL DEFAULT '',
+		pipeline_id text NOT NULL DEFAULT '',
+		pipeline_step integer NOT NULL DEFAULT 0,
+		runtime text NOT NULL DEFAULT '',
+		started_at timestamptz NOT NULL,
+		finished_at timestamptz NOT NULL,
+		duration_ms bigint NOT NULL DEFAULT 0,
+		outcome text NOT NULL,
+		error_code text NOT NULL DEFAULT '',
+		error_message text NOT NULL DEFAULT '',
+		payload_size bigint NOT NULL DEFAULT 0,
+		output_size bigint NOT NULL DEFAULT 0,
+		stderr text NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS executions_started_at_idx ON converter_catalogue.executions (started_at)`,
+	`CREATE INDEX IF NOT EXISTS executions_plugin_id_idx ON converter_catalogue.executions (plugin_id, started_at)`,
+	`CREATE INDEX IF NOT EXISTS executions_distribution_id_idx ON converter_catalogue.executions (distribution_id, started_at)`,
+	`CREATE INDEX IF NOT EXISTS executions_correlation_id_idx ON converter_catalogue.executions (correlation_id)`,
+}
+
+func migrate(db *gorm.DB) error {
+	for i, statement := range migrations {
+		log.Debug("applying migration", "index", i)
+		if err := db.Exec(statement).Error; err != nil {
+			log.Error("failed to apply migration", "index", i, "error", err)
+			return fmt.Errorf("error applying migration %d: %w", i, err)
+		}
+	}
+	log.Info("database migrations applied", "count", len(migrations))
+	return nil
+}
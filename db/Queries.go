@@ -1,9 +1,13 @@
 package db
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/epos-eu/converter-service/dao/model"
+	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
@@ -44,6 +48,40 @@ func GetPluginRelationForEnabledPlugins() ([]model.PluginRelation, error) {
 	return listOfPluginRelation, nil
 }
 
+// GetEnabledPluginRelationsByRelationID returns the relations of the distribution pointing at a plugin that is enabled
+// and installed, or at a pipeline whose plugins all are
+func GetEnabledPluginRelationsByRelationID(relationID string) ([]model.PluginRelation, error) {
+	db := Get()
+
+	var relations []model.PluginRelation
+	err := db.
+		Joins("LEFT JOIN converter_catalogue.plugin ON converter_catalogue.plugin.id = converter_catalogue.plugin_relations.plugin_id").
+		Joins("LEFT JOIN converter_catalogue.pipeline ON converter_catalogue.pipeline.id = converter_catalogue.plugin_relations.pipeline_id").
+		Where("converter_catalogue.plugin_relations.relation_id = ?", relationID).
+		Where(`(converter_catalogue.plugin_relations.pipeline_id IS NULL AND converter_catalogue.plugin.enabled = ? AND converter_catalogue.plugin.installed = ?)
+			OR (converter_catalogue.pipeline.id IS NOT NULL AND NOT EXISTS (
+				SELECT 1 FROM jsonb_array_elements(converter_catalogue.pipeline.steps) AS step
+				LEFT JOIN converter_catalogue.plugin AS step_plugin ON step_plugin.id::text = step->>'plugin_id'
+				WHERE step_plugin.id IS NULL OR NOT (step_plugin.enabled AND step_plugin.installed)))`, true, true).
+		Find(&relations).Error
+	if err != nil {
+		return nil, err
+	}
+	return relations, nil
+}
+
+// GetPipelineRelations returns all the relations pointing at a pipeline
+func GetPipelineRelations() ([]model.PluginRelation, error) {
+	db := Get()
+
+	var relations []model.PluginRelation
+	err := db.Where("pipeline_id IS NOT NULL").Find(&relations).Error
+	if err != nil {
+		return nil, err
+	}
+	return relations, nil
+}
+
 func GetPluginRelationByID(id string) (model.PluginRelation, error) {
 	var plugin model.PluginRelation
 	db := Get()
@@ -60,7 +98,7 @@ func GetPluginRelationsByRelationID(relationID string) ([]model.PluginRelation,
 
 	var relations []model.PluginRelation
 	err := db.
-		Joins("JOIN converter_catalogue.plugin ON converter_catalogue.plugin.id = converter_catalogue.plugin_relations.plugin_id").
+		Joins("LEFT JOIN converter_catalogue.plugin ON converter_catalogue.plugin.id = converter_catalogue.plugin_relations.plugin_id").
 		Where("converter_catalogue.plugin_relations.relation_id = ?", relationID).
 		Find(&relations).Error
 	if err != nil {
@@ -225,3 +263,368 @@ func DeletePluginRelationsByRelationID(relationID string) (int64, error) {
 
 	return result.RowsAffected, nil
 }
+
+func GetPipelines() ([]model.Pipeline, error) {
+	db := Get()
+
+	var pipelines []model.Pipeline
+	err := db.Model(&pipelines).Find(&pipelines).Error
+	if err != nil {
+		return nil, err
+	}
+	return pipelines, nil
+}
+
+func GetPipelineByID(id string) (model.Pipeline, error) {
+	var pipeline model.Pipeline
+	db := Get()
+
+	err := db.Model(&pipeline).Where("id = ?", id).First(&pipeline).Error
+	if err != nil {
+		return pipeline, err
+	}
+	return pipeline, nil
+}
+
+// CreatePipeline creates a new pipeline in the db
+func CreatePipeline(pipeline model.Pipeline) (model.Pipeline, error) {
+	db := Get()
+
+	err := db.Create(&pipeline).Error
+	if err != nil {
+		return pipeline, err
+	}
+	return pipeline, nil
+}
+
+// UpdatePipeline needs the id of the pipeline to be set
+func UpdatePipeline(pipeline model.Pipeline) error {
+	if pipeline.ID == "" {
+		return fmt.Errorf("pipeline id not set, can't update a pipeline without an ID: %+v", pipeline)
+	}
+	db := Get()
+
+	err := db.Model(&pipeline).Select("*").Updates(pipeline).Error
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+func DeletePipeline(id string) (pipeline model.Pipeline, err error) {
+	db := Get()
+
+	err = db.First(&pipeline, "id = ?", id).Error
+	if err != nil {
+		return pipeline, err
+	}
+
+	err = db.Delete(&pipeline).Error
+	if err != nil {
+		return pipeline, err
+	}
+	return pipeline, nil
+}
+
+// CountRelationsByPipelineID returns the number of relations pointing at the pipeline
+func CountRelationsByPipelineID(pipelineID string) (int64, error) {
+	db := Get()
+
+	var count int64
+	err := db.Model(&model.PluginRelation{}).Where("pipeline_id = ?", pipelineID).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// CreateJob creates a new conversion job in the db
+func CreateJob(job model.ConversionJob) (model.ConversionJob, error) {
+	db := Get()
+
+	err := db.Create(&job).Error
+	if err != nil {
+		return job, err
+	}
+	return job, nil
+}
+
+// GetJobByID returns the job, its result is read with JobResult
+func GetJobByID(id string) (model.ConversionJob, error) {
+	var job model.ConversionJob
+	db := Get()
+
+	err := db.Model(&job).Where("id = ?", id).First(&job).Error
+	if err != nil {
+		return job, err
+	}
+	return job, nil
+}
+
+// StartJob moves a queued job to running, it returns false if the job is not queued anymore
+func StartJob(id string, startedAt time.Time) (bool, error) {
+	db := Get()
+
+	result := db.Model(&model.ConversionJob{}).
+		Where("id = ? AND state = ?", id, model.JobQueued).
+		Updates(map[string]any{"state": model.JobRunning, "started_at": startedAt})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// errJobFinished rolls back the transaction of FinishJob when the job was already finished
+var errJobFinished = errors.New("the job is already finished")
+
+// FinishJob sets the final state of a job that is not finished yet, with its result or its error. The result is stored
+// in a large object. It returns false if the job was already finished, which is when it was cancelled. It cancels a job
+// when its state is cancelled.
+func FinishJob(job model.ConversionJob) (bool, error) {
+	db := Get()
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if job.Result != nil {
+			var oid uint32
+			if err := tx.Raw("SELECT lo_from_bytea(0, ?)", job.Result).Row().Scan(&oid); err != nil {
+				return fmt.Errorf("error storing the result: %w", err)
+			}
+			job.ResultOID, job.ResultSize = &oid, int64(len(job.Result))
+		}
+
+		result := tx.Model(&model.ConversionJob{}).
+			Where("id = ? AND state IN ?", job.ID, []model.JobState{model.JobQueued, model.JobRunning}).
+			Select("state", "error", "result_oid", "result_size", "finished_at", "expires_at").
+			Updates(&job)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// rolls back the large object of the result
+			return errJobFinished
+		}
+		return nil
+	})
+	if errors.Is(err, errJobFinished) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// GetJobState returns the state of the job
+func GetJobState(id string) (model.JobState, error) {
+	db := Get()
+
+	var state model.JobState
+	err := db.Model(&model.ConversionJob{}).Where("id = ?", id).Pluck("state", &state).Error
+	if err != nil {
+		return "", err
+	}
+	return state, nil
+}
+
+// DeleteJob deletes the job along with the large object of its result
+func DeleteJob(id string) error {
+	db := Get()
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("SELECT lo_unlink(result_oid) FROM "+model.TableNameConversionJob+" WHERE id = ? AND result_oid IS NOT NULL", id).Error
+		if err != nil {
+			return fmt.Errorf("error deleting the result: %w", err)
+		}
+		return tx.Delete(&model.ConversionJob{}, "id = ?", id).Error
+	})
+}
+
+// DeleteExpiredJobs deletes the jobs that expired before now, along with the large objects of their results, and
+// returns their number
+func DeleteExpiredJobs(now time.Time) (int64, error) {
+	db := Get()
+
+	var deleted int64
+	err := db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Exec("SELECT lo_unlink(result_oid) FROM "+model.TableNameConversionJob+" WHERE expires_at < ? AND result_oid IS NOT NULL", now).Error
+		if err != nil {
+			return fmt.Errorf("error deleting the results: %w", err)
+		}
+		result := tx.Where("expires_at < ?", now).Delete(&model.ConversionJob{})
+		deleted = result.RowsAffected
+		return result.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+	return deleted, nil
+}
+
+// FailJobsOfOwner fails the jobs of the replica that are not finished, they were interrupted by its restart
+func FailJobsOfOwner(owner string, jobErr model.JobError, finishedAt, expiresAt time.Time) (int64, error) {
+	db := Get()
+
+	errJSON, err := json.Marshal(jobErr)
+	if err != nil {
+		return 0, fmt.Errorf("error converting the job error to json: %w", err)
+	}
+
+	result := db.Model(&model.ConversionJob{}).
+		Where("owner = ? AND state IN ?", owner, []model.JobState{model.JobQueued, model.JobRunning}).
+		Updates(map[string]any{
+			"state":       model.JobFailed,
+			"error":       string(errJSON),
+			"finished_at": finishedAt,
+			"expires_at":  expiresAt,
+		})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
+
+// GetFixturesByPluginID returns the fixtures of the plugin, ordered by name
+func GetFixturesByPluginID(pluginID string) ([]model.PluginFixture, error) {
+	var fixtures []model.PluginFixture
+	db := Get()
+
+	err := db.Where("plugin_id = ?", pluginID).Order("name").Find(&fixtures).Error
+	if err != nil {
+		return nil, err
+	}
+	return fixtures, nil
+}
+
+// GetPluginIDsWithFixtures returns the ids of the plugins having at least one fixture
+func GetPluginIDsWithFixtures() ([]string, error) {
+	var ids []string
+	db := Get()
+
+	err := db.Model(&model.PluginFixture{}).Distinct().Order("plugin_id").Pluck("plugin_id", &ids).Error
+	if err != nil {
+		return nil, err
+	}
+	return ids, nil
+}
+
+func GetFixtureByID(pluginID, id string) (model.PluginFixture, error) {
+	var fixture model.PluginFixture
+	db := Get()
+
+	err := db.Where("plugin_id = ? AND id = ?", pluginID, id).First(&fixture).Error
+	if err != nil {
+		return fixture, err
+	}
+	return fixture, nil
+}
+
+func CreateFixture(fixture model.PluginFixture) (model.PluginFixture, error) {
+	db := Get()
+
+	err := db.Create(&fixture).Error
+	if err != nil {
+		return fixture, err
+	}
+	return fixture, nil
+}
+
+// UpdateFixture needs the id of the fixture to be set
+func UpdateFixture(fixture model.PluginFixture) error {
+	if fixture.ID == "" {
+		return fmt.Errorf("fixture id not set, can't update a fixture without an ID: %+v", fixture)
+	}
+	db := Get()
+
+	return db.Model(&fixture).Select("*").Updates(fixture).Error
+}
+
+func DeleteFixture(pluginID, id string) (fixture model.PluginFixture, err error) {
+	db := Get()
+
+	err = db.First(&fixture, "plugin_id = ? AND id = ?", pluginID, id).Error
+	if err != nil {
+		return fixture, err
+	}
+
+	err = db.Delete(&fixture).Error
+	if err != nil {
+		return fixture, err
+	}
+	return fixture, nil
+}
+
+// ExecutionFilter selects the executions returned by GetExecutions, the fields left empty don't filter
+type ExecutionFilter struct {
+	PluginID       string
+	DistributionID string
+	CorrelationID  string
+	PipelineID     string
+	Outcome        model.ExecutionOutcome
+	ErrorCode      string
+	// the executions started in [Since, Until)
+	Since time.Time
+	Until time.Time
+}
+
+func CreateExecution(execution model.Execution) error {
+	db := Get()
+
+	return db.Create(&execution).Error
+}
+
+// GetExecutions returns a page of the executions matching the filter, the most recent first, and the number of
+// executions matching it
+func GetExecutions(filter ExecutionFilter, limit, offset int) ([]model.Execution, int64, error) {
+	db := Get()
+
+	query := db.Model(&model.Execution{})
+	if filter.PluginID != "" {
+		query = query.Where("plugin_id = ?", filter.PluginID)
+	}
+	if filter.DistributionID != "" {
+		query = query.Where("distribution_id = ?", filter.DistributionID)
+	}
+	if filter.CorrelationID != "" {
+		query = query.Where("correlation_id = ?", filter.CorrelationID)
+	}
+	if filter.PipelineID != "" {
+		query = query.Where("pipeline_id = ?", filter.PipelineID)
+	}
+	if filter.Outcome != "" {
+		query = query.Where("outcome = ?", filter.Outcome)
+	}
+	if filter.ErrorCode != "" {
+		query = query.Where("error_code = ?", filter.ErrorCode)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("started_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("started_at < ?", filter.Until)
+	}
+
+	// the count and the page are queried with the same conditions
+	query = query.Session(&gorm.Session{})
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var executions []model.Execution
+	err := query.Order("started_at DESC, id").Limit(limit).Offset(offset).Find(&executions).Error
+	if err != nil {
+		return nil, 0, err
+	}
+	return executions, total, nil
+}
+
+// DeleteExecutionsBefore deletes the executions started before t and returns their number
+func DeleteExecutionsBefore(t time.Time) (int64, error) {
+	db := Get()
+
+	result := db.Where("started_at < ?", t).Delete(&model.Execution{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	return result.RowsAffected, nil
+}
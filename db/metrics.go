@@ -0,0 +1,67 @@
+package db
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/epos-eu/converter-service/metrics"
+	"gorm.io/gorm"
+)
+
+// the setting of the statement holding the time its query started
+const queryStartKey = "metrics:query_start"
+
+// registerMetrics records the duration of every query, with callbacks run around the ones of gorm. The operation
+// comes from the kind of statement, so the SQL does not have to be rendered with its values.
+func registerMetrics(db *gorm.DB) error {
+	callbacks := db.Callback()
+	create, query, update, del := callbacks.Create(), callbacks.Query(), callbacks.Update(), callbacks.Delete()
+	row, raw := callbacks.Row(), callbacks.Raw()
+	return errors.Join(
+		create.Before("*").Register("metrics:start_create", startQuery),
+		create.After("*").Register("metrics:observe_create", observeQuery("insert")),
+		query.Before("*").Register("metrics:start_query", startQuery),
+		query.After("*").Register("metrics:observe_query", observeQuery("select")),
+		update.Before("*").Register("metrics:start_update", startQuery),
+		update.After("*").Register("metrics:observe_update", observeQuery("update")),
+		del.Before("*").Register("metrics:start_delete", startQuery),
+		del.After("*").Register("metrics:observe_delete", observeQuery("delete")),
+		// Row, Rows, Raw and Exec can run any statement
+		row.Before("*").Register("metrics:start_row", startQuery),
+		row.After("*").Register("metrics:observe_row", observeQuery("")),
+		raw.Before("*").Register("metrics:start_raw", startQuery),
+		raw.After("*").Register("metrics:observe_raw", observeQuery("")),
+	)
+}
+
+func startQuery(db *gorm.DB) {
+	db.InstanceSet(queryStartKey, time.Now())
+}
+
+// observeQuery returns the callback recording the duration of the query, from the statement when the operation is
+// empty
+func observeQuery(operation string) func(*gorm.DB) {
+	return func(db *gorm.DB) {
+		start, ok := db.InstanceGet(queryStartKey)
+		if !ok {
+			return
+		}
+		op := operation
+		if op == "" {
+			op = queryOperation(db.Statement.SQL.String())
+		}
+		metrics.DBQueryDuration.WithLabelValues(op).Observe(time.Since(start.(time.Time)).Seconds())
+	}
+}
+
+// queryOperation returns the operation of the query, from its first keyword
+func queryOperation(sql string) string {
+	keyword, _, _ := strings.Cut(strings.TrimSpace(sql), " ")
+	switch keyword = strings.ToLower(keyword); keyword {
+	case "select", "insert", "update", "delete":
+		return keyword
+	default:
+		return "other"
+	}
+}
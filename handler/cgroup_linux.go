@@ -0,0 +1,150 @@
+//go:build linux
+
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/epos-eu/converter-service/internal/env"
+)
+
+const (
+	cgroupMount = "/sys/fs/cgroup"
+	// CGROUP2_SUPER_MAGIC from linux/magic.h
+	cgroup2Magic = 0x63677270
+)
+
+var (
+	cgroupOnce sync.Once
+	// the cgroup under which the plugin cgroups are created, empty if cgroups can't be used
+	cgroupParent string
+)
+
+// setupCgroups checks the cgroup v2 under which a child group with the memory controller is created for each plugin.
+// PLUGIN_CGROUP is the path of a cgroup delegated to the service, prepared with the memory controller enabled for its
+// children (and so without any process of its own). The service never moves itself nor changes the controllers, cgroups
+// are not used when it is empty or off.
+func setupCgroups() {
+	path := env.Get("PLUGIN_CGROUP", "")
+	if path == "" || path == "off" {
+		log.Info("plugin cgroups disabled, memory will be limited with rlimits")
+		return
+	}
+	if err := checkCgroup(path); err != nil {
+		log.Warn("cgroup v2 not available for plugins, memory will be limited with rlimits", "cgroup", path, "error", err)
+		return
+	}
+	cgroupParent = path
+	log.Info("plugin memory limits enforced with cgroups", "cgroup", cgroupParent)
+}
+
+func checkCgroup2(path string) error {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return fmt.Errorf("error reading the filesystem of %s: %w", path, err)
+	}
+	if fs.Type != cgroup2Magic {
+		return fmt.Errorf("%s is not a cgroup v2 (only the unified hierarchy is supported)", path)
+	}
+	return nil
+}
+
+func checkCgroup(path string) error {
+	if err := checkCgroup2(path); err != nil {
+		return err
+	}
+	controllers, err := os.ReadFile(filepath.Join(path, "cgroup.subtree_control"))
+	if err != nil {
+		return fmt.Errorf("error reading the controllers of %s: %w", path, err)
+	}
+	if !strings.Contains(string(controllers), "memory") {
+		return fmt.Errorf("the memory controller is not enabled for the children of %s", path)
+	}
+	return nil
+}
+
+// cgroup is the cgroup of a single plugin execution
+type cgroup struct {
+	path string
+	dir  *os.File
+}
+
+func newCgroup(name string, memoryMax uint64) (*cgroup, error) {
+	cgroupOnce.Do(setupCgroups)
+	if cgroupParent == "" {
+		return nil, fmt.Errorf("no cgroup available")
+	}
+
+	path := filepath.Join(cgroupParent, "plugin-"+name)
+	if err := os.Mkdir(path, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating cgroup: %w", err)
+	}
+	cg := &cgroup{path: path}
+	if err := os.WriteFile(filepath.Join(path, "memory.max"), []byte(strconv.FormatUint(memoryMax, 10)), 0o644); err != nil {
+		cg.remove()
+		return nil, fmt.Errorf("error setting the memory limit: %w", err)
+	}
+	// without this the plugin could use swap to go past the limit (the file is missing when swap is not accounted)
+	_ = os.WriteFile(filepath.Join(path, "memory.swap.max"), []byte("0"), 0o644)
+
+	dir, err := os.Open(path)
+	if err != nil {
+		cg.remove()
+		return nil, fmt.Errorf("error opening cgroup: %w", err)
+	}
+	cg.dir = dir
+	return cg, nil
+}
+
+// attach makes cmd start directly inside the cgroup
+func (c *cgroup) attach(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.UseCgroupFD = true
+	cmd.SysProcAttr.CgroupFD = int(c.dir.Fd())
+}
+
+// oomKilled reports whether a process of the cgroup was killed for going over the memory limit
+func (c *cgroup) oomKilled() bool {
+	events, err := os.ReadFile(filepath.Join(c.path, "memory.events"))
+	if err != nil {
+		log.Warn("error reading cgroup memory events", "cgroup", c.path, "error", err)
+		return false
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(events))
+	for scanner.Scan() {
+		if count, ok := strings.CutPrefix(scanner.Text(), "oom_kill "); ok {
+			return count != "0"
+		}
+	}
+	return false
+}
+
+// remove kills whatever is left in the cgroup and deletes it
+func (c *cgroup) remove() {
+	if c.dir != nil {
+		_ = c.dir.Close()
+	}
+	// cgroup.kill is only available from linux 5.14, the process group of the plugin is killed anyway
+	_ = os.WriteFile(filepath.Join(c.path, "cgroup.kill"), []byte("1"), 0o644)
+	// the killed processes may take a moment to leave the cgroup
+	var err error
+	for range 10 {
+		if err = os.Remove(c.path); err == nil {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	log.Warn("error removing plugin cgroup", "cgroup", c.path, "error", err)
+}
@@ -0,0 +1,42 @@
+//go:build linux
+
+package handler
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/epos-eu/converter-service/dao/model"
+)
+
+func TestLimitGuardCheckOOMKill(t *testing.T) {
+	tests := []struct {
+		name   string
+		events string
+		script string
+		want   bool
+	}{
+		{name: "oom kill", events: "low 0\nhigh 0\nmax 12\noom 1\noom_kill 1\n", script: "kill -KILL $$", want: true},
+		// the plugin can survive reaching the limit, only a kill counts
+		{name: "oom without a kill", events: "low 0\nhigh 0\nmax 12\noom 1\noom_kill 0\n", script: "exit 0"},
+		{name: "no events", script: "exit 0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			if test.events != "" {
+				if err := os.WriteFile(filepath.Join(dir, "memory.events"), []byte(test.events), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			guard := &limitGuard{limits: model.ResourceLimits{MemoryMB: 64}, cgroup: &cgroup{path: dir}}
+			err := guard.check(exitState(t, test.script), "")
+			limitErr, ok := errors.AsType[*LimitError](err)
+			if ok != test.want || ok && limitErr.Limit != "memory" {
+				t.Errorf("got %v, want a memory limit error: %t", err, test.want)
+			}
+		})
+	}
+}
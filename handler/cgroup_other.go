@@ -0,0 +1,21 @@
+//go:build !linux
+
+package handler
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+// cgroup is not available outside of linux, memory is always limited with rlimits
+type cgroup struct{}
+
+func newCgroup(string, uint64) (*cgroup, error) {
+	return nil, fmt.Errorf("cgroups are only available on linux")
+}
+
+func (*cgroup) attach(*exec.Cmd) {}
+
+func (*cgroup) oomKilled() bool { return false }
+
+func (*cgroup) remove() {}
@@ -0,0 +1,29 @@
+package handler
+
+import "context"
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a copy of ctx carrying the correlation id of the message being handled
+func WithCorrelationID(ctx context.Context, correlationID string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, correlationID)
+}
+
+// correlationID returns the correlation id carried by ctx, if any
+func correlationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+type pipelineStepKey struct{}
+
+// withPipelineStep returns a copy of ctx carrying the number of the step of the pipeline being run
+func withPipelineStep(ctx context.Context, step int) context.Context {
+	return context.WithValue(ctx, pipelineStepKey{}, step)
+}
+
+// pipelineStep returns the number of the step of the pipeline carried by ctx, 0 outside of a pipeline
+func pipelineStep(ctx context.Context) int {
+	step, _ := ctx.Value(pipelineStepKey{}).(int)
+	return step
+}
@@ -0,0 +1,63 @@
+//go:build linux
+
+package handler
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// userHZ is the unit of the times of /proc/<pid>/stat, 100 on every architecture the service runs on
+const userHZ = 100
+
+// processCPUTime returns the CPU time used so far by the process, all its threads included
+func processCPUTime(pid int) (time.Duration, error) {
+	stat, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/stat")
+	if err != nil {
+		return 0, fmt.Errorf("error reading the process stat: %w", err)
+	}
+	// the name of the command, in parentheses, may contain spaces
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0, fmt.Errorf("invalid process stat")
+	}
+	// utime and stime are the fields 14 and 15, the fields after the name start at 3
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 13 {
+		return 0, fmt.Errorf("invalid process stat")
+	}
+	var ticks int64
+	for _, field := range fields[11:13] {
+		n, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid process stat: %w", err)
+		}
+		ticks += n
+	}
+	return time.Duration(ticks) * time.Second / userHZ, nil
+}
+
+// cpuTime returns the CPU time used so far by the processes of the cgroup, the exited ones included
+func (c *cgroup) cpuTime() (time.Duration, error) {
+	stat, err := os.ReadFile(filepath.Join(c.path, "cpu.stat"))
+	if err != nil {
+		return 0, fmt.Errorf("error reading the cgroup cpu stat: %w", err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(stat))
+	for scanner.Scan() {
+		if usage, ok := strings.CutPrefix(scanner.Text(), "usage_usec "); ok {
+			n, err := strconv.ParseInt(usage, 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid cgroup cpu stat: %w", err)
+			}
+			return time.Duration(n) * time.Microsecond, nil
+		}
+	}
+	return 0, fmt.Errorf("no usage in the cgroup cpu stat")
+}
@@ -0,0 +1,46 @@
+//go:build linux
+
+package handler
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestProcessCPUTime(t *testing.T) {
+	before, err := processCPUTime(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// USER_HZ ticks are 10ms, burn well over one
+	for start := time.Now(); time.Since(start) < 100*time.Millisecond; {
+	}
+	after, err := processCPUTime(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after <= before {
+		t.Errorf("CPU time did not increase: %s then %s", before, after)
+	}
+
+	if _, err := processCPUTime(-1); err == nil {
+		t.Error("expected an error for a missing process")
+	}
+}
+
+func TestCgroupCPUTime(t *testing.T) {
+	dir := t.TempDir()
+	stat := "usage_usec 2500000\nuser_usec 2000000\nsystem_usec 500000\n"
+	if err := os.WriteFile(filepath.Join(dir, "cpu.stat"), []byte(stat), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := (&cgroup{path: dir}).cpuTime()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 2500*time.Millisecond {
+		t.Errorf("got %s, want 2.5s", got)
+	}
+}
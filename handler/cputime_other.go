@@ -0,0 +1,16 @@
+//go:build !linux
+
+package handler
+
+import (
+	"fmt"
+	"time"
+)
+
+func processCPUTime(int) (time.Duration, error) {
+	return 0, fmt.Errorf("the CPU time of a running process is only available on linux")
+}
+
+func (*cgroup) cpuTime() (time.Duration, error) {
+	return 0, fmt.Errorf("cgroups are only available on linux")
+}
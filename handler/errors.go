@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// ErrorCode tells the callers why a message could not be handled
+type ErrorCode string
+
+const (
+	// the message is not valid
+	CodeBadMessage ErrorCode = "bad_message"
+	// the plugin (or pipeline) does not exist, or none matches the requested content types
+	CodePluginNotFound ErrorCode = "plugin_not_found"
+	// the plugin exists but is disabled
+	CodePluginDisabled ErrorCode = "plugin_disabled"
+	// the plugin failed during the conversion
+	CodePluginFailed ErrorCode = "plugin_failed"
+	// the plugin did not finish within its timeout
+	CodeTimeout ErrorCode = "timeout"
+	// the plugin did not write a valid output
+	CodeInvalidOutput ErrorCode = "invalid_output"
+	// the service failed for a reason unrelated to the message or the plugin
+	CodeInternal ErrorCode = "internal_error"
+)
+
+// Error is returned by the handlers when a message can't be handled, Code classifies the failure
+type Error struct {
+	Code ErrorCode
+	// the plugin being run when the error happened, if any
+	PluginID string
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(code ErrorCode, pluginID string, err error) *Error {
+	return &Error{Code: code, PluginID: pluginID, Err: err}
+}
+
+// notFoundOr returns a plugin_not_found error if err is a record not found error, and an internal error otherwise
+func notFoundOr(pluginID string, err error) *Error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return newError(CodePluginNotFound, pluginID, err)
+	}
+	return newError(CodeInternal, pluginID, err)
+}
+
+// ErrorReply is the body published back in place of the response when a message can't be handled
+type ErrorReply struct {
+	Error ErrorEnvelope `json:"error"`
+}
+
+type ErrorEnvelope struct {
+	Code     ErrorCode `json:"code"`
+	Message  string    `json:"message"`
+	PluginID string    `json:"pluginId,omitempty"`
+	// the tail of the stderr of the plugin, when it failed
+	Stderr string `json:"stderr,omitempty"`
+}
+
+// NewErrorReply returns the ErrorReply describing err. Errors that are not an *Error are internal errors.
+func NewErrorReply(err error) ErrorReply {
+	envelope := ErrorEnvelope{Code: CodeInternal, Message: errorMessage(err)}
+	if handlerErr, ok := errors.AsType[*Error](err); ok {
+		envelope.Code = handlerErr.Code
+		envelope.PluginID = handlerErr.PluginID
+	}
+	if execErr, ok := errors.AsType[*ExecutionError](err); ok {
+		envelope.Stderr = execErr.Stderr
+	}
+	return ErrorReply{Error: envelope}
+}
+
+// errorMessage returns the message of err without the tail of the stderr of the plugin, that is reported on its own
+func errorMessage(err error) string {
+	message := err.Error()
+	if execErr, ok := errors.AsType[*ExecutionError](err); ok && execErr.Stderr != "" {
+		message = strings.Replace(message, execErr.Error(), execErr.summary(), 1)
+	}
+	return message
+}
+
+// Marshal returns the JSON body of the reply
+func (r ErrorReply) Marshal() ([]byte, error) {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return nil, fmt.Errorf("error converting the error reply to json: %w", err)
+	}
+	return body, nil
+}
@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestNewErrorReply(t *testing.T) {
+	execErr := &ExecutionError{Err: errors.New("error executing the plugin: exit status 1"), Stderr: "Exception in thread \"main\"\n\tat Main.main"}
+	tests := []struct {
+		name string
+		err  error
+		want ErrorEnvelope
+	}{
+		{
+			name: "internal error",
+			err:  errors.New("database unavailable"),
+			want: ErrorEnvelope{Code: CodeInternal, Message: "database unavailable"},
+		},
+		{
+			name: "handler error",
+			err:  newError(CodePluginDisabled, "p1", errors.New("plugin p1 is disabled")),
+			want: ErrorEnvelope{Code: CodePluginDisabled, Message: "plugin p1 is disabled", PluginID: "p1"},
+		},
+		{
+			name: "plugin failure",
+			err:  newError(CodePluginFailed, "p1", execErr),
+			want: ErrorEnvelope{
+				Code:     CodePluginFailed,
+				Message:  "error executing the plugin: exit status 1",
+				PluginID: "p1",
+				Stderr:   execErr.Stderr,
+			},
+		},
+		{
+			name: "wrapped plugin failure",
+			err:  fmt.Errorf("step 1/2 of pipeline x failed: %w", newError(CodePluginFailed, "p1", execErr)),
+			want: ErrorEnvelope{
+				Code:     CodePluginFailed,
+				Message:  "step 1/2 of pipeline x failed: error executing the plugin: exit status 1",
+				PluginID: "p1",
+				Stderr:   execErr.Stderr,
+			},
+		},
+		{
+			name: "plugin failure without stderr",
+			err:  newError(CodePluginFailed, "p1", &ExecutionError{Err: errors.New("exit status 2")}),
+			want: ErrorEnvelope{Code: CodePluginFailed, Message: "exit status 2", PluginID: "p1"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := NewErrorReply(test.err).Error; got != test.want {
+				t.Errorf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
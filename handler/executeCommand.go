@@ -1,42 +1,164 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"log/slog"
 	"math/rand"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"time"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/launcher"
+	"github.com/epos-eu/converter-service/tracing"
+	"github.com/google/uuid"
 )
 
-func executeCommand(payload string, cmd *exec.Cmd) ([]byte, error) {
+// ErrPluginTimeout is returned when a plugin does not finish before its timeout
+var ErrPluginTimeout = errors.New("plugin execution timed out")
+
+// traceparentEnv is the environment variable holding the W3C traceparent of the execution of a plugin
+const traceparentEnv = "TRACEPARENT"
+
+// ExecutionError is returned when the process of a plugin fails, it carries the end of what the plugin wrote on stderr
+type ExecutionError struct {
+	Err    error
+	Stderr string
+}
+
+func (e *ExecutionError) Error() string {
+	if e.Stderr == "" {
+		return e.Err.Error()
+	}
+	return fmt.Sprintf("%v\nTail of stderr:\n%s", e.Err, e.Stderr)
+}
+
+func (e *ExecutionError) Unwrap() error {
+	return e.Err
+}
+
+// summary returns the error without the tail of stderr
+func (e *ExecutionError) summary() string {
+	return e.Err.Error()
+}
+
+// executeCommand runs the plugin on the payload with the command built by its runtime. When ctx is done the whole
+// process group of the plugin is killed
+func executeCommand(ctx context.Context, runtime Runtime, plugin model.Plugin, payload string) ([]byte, error) {
 	currentDir, err := os.Getwd()
 	if err != nil {
 		return nil, fmt.Errorf("error getting current directory: %w", err)
 	}
 
 	// Generate random unique names for the temp input and output files
+	_, span := tracer.Start(ctx, "createTempFiles")
 	tmpDir, inputFile, outputFile, err := createTempFiles(currentDir, payload)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, err
 	}
 	defer cleanupTempFiles(tmpDir)
 
-	// the last two arguments of an executable command have to be the input and the output files
-	cmd.Args = append(cmd.Args, inputFile, outputFile)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	executionLog := log.With(
+		"plugin_id", plugin.ID,
+		"correlation_id", correlationID(ctx),
+		"execution_id", uuid.NewString())
 
-	if err := cmd.Run(); err != nil {
-		// log the head of the payload that could not be converted for debugging purposes
-		return nil, fmt.Errorf("error executing the plugin: %w\nHead of payload:\n%v", err, getHead(payload, 200))
+	cmd, err := runtime.Command(ctx, plugin, inputFile, outputFile)
+	if err != nil {
+		return nil, fmt.Errorf("error building the plugin command: %w", err)
 	}
+	stdout, stderr := newTailBuffer(outputLimit), newTailBuffer(outputLimit)
+	stdoutLog := newLineLogger(executionLog.With("stream", "stdout"), slog.LevelInfo, outputLimit)
+	stderrLog := newLineLogger(executionLog.With("stream", "stderr"), slog.LevelWarn, outputLimit)
+	cmd.Stdout = io.MultiWriter(stdout, stdoutLog)
+	cmd.Stderr = io.MultiWriter(stderr, stderrLog)
 
+	limits, err := prepareProcess(cmd, plugin, currentDir, tmpDir, 1)
+	if err != nil {
+		return nil, err
+	}
+	defer limits.release()
+	if traceparent := tracing.Traceparent(ctx); traceparent != "" {
+		cmd.Env = append(cmd.Environ(), traceparentEnv+"="+traceparent)
+	}
+
+	start := time.Now()
+	err = cmd.Run()
+	// reap whatever the plugin left running in its process group
+	if cmd.Process != nil {
+		_ = killProcessGroup(cmd.Process)
+	}
+	stdoutLog.flush()
+	stderrLog.flush()
+	executionLog.Debug("plugin process exited", "duration", time.Since(start), "exit_code", cmd.ProcessState.ExitCode())
+	recordProcess(ctx, cmd.ProcessState, stdout, stderr)
+
+	if err := processError(ctx, cmd.ProcessState, err, limits, stderr); err != nil {
+		// log the head of the payload that could not be converted for debugging purposes, it is kept out of the error
+		// as the error is replied to the caller and recorded in the history
+		executionLog.Warn("plugin failed", "head_of_payload", getHead(payload, 200), "error", err)
+		return nil, err
+	}
+
+	return readOutput(outputFile)
+}
+
+// prepareProcess applies to cmd everything that has to be set up before the plugin starts: its own process group, the
+// resource limits and the sandbox. workDir is the name of the directory in serviceDir the plugin can write to, and jobs
+// the number of jobs the process may run. The returned guard must be released once the plugin has exited.
+func prepareProcess(cmd *exec.Cmd, plugin model.Plugin, serviceDir, workDir string, jobs int) (*limitGuard, error) {
+	setProcessGroup(cmd)
+
+	var spec launcher.Spec
+	limits := applyLimits(cmd, &spec, workDir, pluginLimits(plugin), jobs)
+	if sandboxEnabled {
+		if err := applySandbox(cmd, &spec, plugin, serviceDir, filepath.Join(serviceDir, workDir)); err != nil {
+			limits.release()
+			return nil, err
+		}
+	}
+	if !spec.IsZero() {
+		if err := launcher.Wrap(cmd, launcherPath, spec); err != nil {
+			limits.release()
+			return nil, fmt.Errorf("error preparing the plugin process: %w", err)
+		}
+	}
+	return limits, nil
+}
+
+// processError returns why the process of a plugin, that exited with state and err, failed. It returns nil if it
+// didn't fail.
+func processError(ctx context.Context, state *os.ProcessState, err error, limits *limitGuard, stderr *tailBuffer) *ExecutionError {
+	stderrTail := stderr.tail(stderrTailLength)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return &ExecutionError{Err: fmt.Errorf("%w: %w", ErrPluginTimeout, ctx.Err()), Stderr: stderrTail}
+	}
+	if limitErr := limits.check(state, stderr.String()); limitErr != nil {
+		return &ExecutionError{Err: limitErr, Stderr: stderrTail}
+	}
+	if err != nil {
+		return &ExecutionError{Err: fmt.Errorf("error executing the plugin: %w", err), Stderr: stderrTail}
+	}
+	return nil
+}
+
+// readOutput reads the output file written by a plugin
+func readOutput(outputFile string) ([]byte, error) {
 	output, err := os.ReadFile(outputFile)
 	if err != nil {
-		return nil, fmt.Errorf("error reading output file: %w", err)
+		return nil, newError(CodeInvalidOutput, "", fmt.Errorf("error reading output file: %w", err))
 	}
+	return output, nil
+}
 
+// wrapOutput wraps the output of a conversion, which must be a JSON object, in a Response
+func wrapOutput(output []byte) ([]byte, error) {
 	var outputMap map[string]any
 	if err := json.Unmarshal(output, &outputMap); err != nil {
 		return nil, fmt.Errorf("error parsing output json: %w", err)
@@ -0,0 +1,333 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/epos-eu/converter-service/dao/model"
+)
+
+// the differences reported for a fixture, the following ones are left out
+const maxDifferences = 50
+
+// FixtureReport is the result of running the fixtures of a plugin
+type FixtureReport struct {
+	PluginID string `json:"plugin_id"`
+	// whether every fixture passed
+	Passed   bool            `json:"passed"`
+	Fixtures []FixtureResult `json:"fixtures"`
+	// whether the plugin was disabled because a fixture failed
+	Disabled bool `json:"disabled"`
+	// why the fixtures could not be run
+	Error *ErrorEnvelope `json:"error,omitempty"`
+}
+
+// FixtureResult is the result of running a fixture
+type FixtureResult struct {
+	FixtureID string `json:"fixture_id"`
+	Name      string `json:"name"`
+	Passed    bool   `json:"passed"`
+	// how the output differs from the expected output
+	Differences []Difference `json:"differences"`
+	// why the conversion failed
+	Error      *ErrorEnvelope `json:"error,omitempty"`
+	WallTimeMs int64          `json:"wall_time_ms"`
+}
+
+// Difference is a difference between the output of a plugin and the expected output of a fixture
+type Difference struct {
+	// the JSON pointer of the value, empty for the whole output
+	Path    string `json:"path"`
+	Message string `json:"message"`
+	// the values as JSON, left out when there is no value, so that a missing value is told apart from null
+	Expected json.RawMessage `json:"expected,omitempty"`
+	Actual   json.RawMessage `json:"actual,omitempty"`
+}
+
+// RunFixtures runs the fixtures of the plugin, one after the other, through the same execution path as the
+// conversions. With disableOnFailure, the plugin is disabled when one of them fails. The error is only set if the
+// fixtures could not be run at all.
+func RunFixtures(ctx context.Context, pluginID string, disableOnFailure bool) (FixtureReport, error) {
+	report := FixtureReport{PluginID: pluginID, Fixtures: []FixtureResult{}}
+
+	plugin, err := store.GetPluginByID(pluginID)
+	if err != nil {
+		return report, notFoundOr(pluginID, fmt.Errorf("error getting plugin: %w", err))
+	}
+	if !plugin.Installed {
+		return report, newError(CodePluginDisabled, plugin.ID, fmt.Errorf("plugin %s is not installed", plugin.ID))
+	}
+	fixtures, err := store.GetFixturesByPluginID(plugin.ID)
+	if err != nil {
+		return report, newError(CodeInternal, plugin.ID, fmt.Errorf("error getting the fixtures: %w", err))
+	}
+
+	report.Passed = true
+	for _, fixture := range fixtures {
+		if err := ctx.Err(); err != nil {
+			return report, newError(CodeInternal, plugin.ID, fmt.Errorf("fixtures interrupted: %w", err))
+		}
+		result, err := runFixture(ctx, fixture)
+		if err != nil {
+			return report, err
+		}
+		log.Debug("fixture run", "plugin_id", plugin.ID, "fixture_id", fixture.ID, "passed", result.Passed)
+		report.Passed = report.Passed && result.Passed
+		report.Fixtures = append(report.Fixtures, result)
+	}
+
+	if !report.Passed && disableOnFailure && plugin.Enabled {
+		if err := store.EnablePlugin(plugin.ID, false); err != nil {
+			return report, newError(CodeInternal, plugin.ID, fmt.Errorf("error disabling the plugin: %w", err))
+		}
+		report.Disabled = true
+		log.Warn("plugin disabled, its fixtures failed", "plugin_id", plugin.ID)
+	}
+	return report, nil
+}
+
+// PluginRevision returns the commit the directory of the plugin is checked out at by the converter-routine, or an empty
+// string if the plugin is not installed yet
+func PluginRevision(pluginID string) (string, error) {
+	gitDir := filepath.Join("plugins", pluginID, ".git")
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error reading the HEAD of plugin %s: %w", pluginID, err)
+	}
+
+	ref, symbolic := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: ")
+	if !symbolic {
+		// a detached HEAD, e.g. a tag
+		return ref, nil
+	}
+	commit, err := os.ReadFile(filepath.Join(gitDir, filepath.FromSlash(ref)))
+	if err == nil {
+		return strings.TrimSpace(string(commit)), nil
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("error reading %s of plugin %s: %w", ref, pluginID, err)
+	}
+	// the refs of a fresh clone are packed
+	packed, err := os.ReadFile(filepath.Join(gitDir, "packed-refs"))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("error reading the packed refs of plugin %s: %w", pluginID, err)
+	}
+	for line := range strings.Lines(string(packed)) {
+		if commit, name, ok := strings.Cut(strings.TrimSpace(line), " "); ok && name == ref {
+			return commit, nil
+		}
+	}
+	return "", fmt.Errorf("ref %s of plugin %s not found", ref, pluginID)
+}
+
+// runFixture runs the plugin of the fixture on its input and compares the output to the expected one
+func runFixture(ctx context.Context, fixture model.PluginFixture) (FixtureResult, error) {
+	result := FixtureResult{FixtureID: fixture.ID, Name: fixture.Name, Differences: []Difference{}}
+
+	test, err := TestPlugin(ctx, fixture.PluginID, Message{
+		Parameters: Parameters{
+			DistributionID: fixture.DistributionID,
+			RequestFormat:  fixture.RequestContentType,
+			ResponseFormat: fixture.ResponseContentType,
+		},
+		Payload: fixture.Input,
+	})
+	if err != nil {
+		return result, err
+	}
+	result.WallTimeMs = test.WallTimeMs
+	if test.Error != nil {
+		result.Error = test.Error
+		return result, nil
+	}
+
+	result.Differences = compareOutput(fixture, []byte(test.Output))
+	result.Passed = len(result.Differences) == 0
+	return result, nil
+}
+
+// compareOutput returns how the output differs from the expected output of the fixture
+func compareOutput(fixture model.PluginFixture, output []byte) []Difference {
+	if fixture.Compare == model.CompareExact {
+		return compareExact(fixture.Expected, string(output))
+	}
+
+	var expected, actual any
+	if err := json.Unmarshal([]byte(fixture.Expected), &expected); err != nil {
+		return []Difference{{Message: "the expected output is not valid JSON: " + err.Error()}}
+	}
+	if err := json.Unmarshal(output, &actual); err != nil {
+		// compared as text, to show where the output goes wrong
+		differences := compareExact(fixture.Expected, string(output))
+		for i := range differences {
+			differences[i].Message = "the output is not valid JSON, " + differences[i].Message
+		}
+		return differences
+	}
+	diff := jsonDiff{tolerance: fixture.Tolerance, ignorePaths: fixture.IgnorePaths, differences: []Difference{}}
+	diff.compare("", expected, actual)
+	return diff.differences
+}
+
+// compareExact reports the first line where the output differs from the expected output
+func compareExact(expected, actual string) []Difference {
+	expected, actual = strings.TrimSpace(expected), strings.TrimSpace(actual)
+	if expected == actual {
+		return []Difference{}
+	}
+
+	expectedLines, actualLines := strings.Split(expected, "\n"), strings.Split(actual, "\n")
+	for i := range max(len(expectedLines), len(actualLines)) {
+		// a line past the end is left out
+		var e, a json.RawMessage
+		if i < len(expectedLines) {
+			e = jsonValue(expectedLines[i])
+		}
+		if i < len(actualLines) {
+			a = jsonValue(actualLines[i])
+		}
+		if !bytes.Equal(e, a) || e == nil || a == nil {
+			return []Difference{{
+				Message:  fmt.Sprintf("the output differs from line %d (%d lines expected, %d written)", i+1, len(expectedLines), len(actualLines)),
+				Expected: e,
+				Actual:   a,
+			}}
+		}
+	}
+	return []Difference{}
+}
+
+// jsonDiff collects the differences between two decoded JSON values
+type jsonDiff struct {
+	// the maximum absolute difference between two equal numbers
+	tolerance float64
+	// the JSON pointers of the values not compared, with their children
+	ignorePaths []string
+	differences []Difference
+}
+
+func (d *jsonDiff) compare(path string, expected, actual any) {
+	if d.ignored(path) {
+		return
+	}
+
+	switch e := expected.(type) {
+	case map[string]any:
+		a, ok := actual.(map[string]any)
+		if !ok {
+			d.add(path, "expected object, got "+jsonType(actual), nil, jsonValue(actual))
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(e)) {
+			child := path + "/" + escapePointer(key)
+			value, ok := a[key]
+			if !ok {
+				if !d.ignored(child) {
+					d.add(child, "missing", jsonValue(e[key]), nil)
+				}
+				continue
+			}
+			d.compare(child, e[key], value)
+		}
+		for _, key := range slices.Sorted(maps.Keys(a)) {
+			child := path + "/" + escapePointer(key)
+			if _, ok := e[key]; !ok && !d.ignored(child) {
+				d.add(child, "unexpected", nil, jsonValue(a[key]))
+			}
+		}
+	case []any:
+		a, ok := actual.([]any)
+		if !ok {
+			d.add(path, "expected array, got "+jsonType(actual), nil, jsonValue(actual))
+			return
+		}
+		if len(e) != len(a) {
+			d.add(path, fmt.Sprintf("expected %d items, got %d", len(e), len(a)), nil, nil)
+		}
+		for i := range min(len(e), len(a)) {
+			d.compare(fmt.Sprintf("%s/%d", path, i), e[i], a[i])
+		}
+	case float64:
+		a, ok := actual.(float64)
+		if !ok {
+			d.add(path, "expected number, got "+jsonType(actual), jsonValue(e), jsonValue(actual))
+			return
+		}
+		if math.Abs(e-a) > d.tolerance {
+			d.add(path, "values differ", jsonValue(e), jsonValue(a))
+		}
+	default:
+		// strings, booleans and null
+		if jsonType(expected) != jsonType(actual) {
+			d.add(path, "expected "+jsonType(expected)+", got "+jsonType(actual), jsonValue(expected), jsonValue(actual))
+			return
+		}
+		if expected != actual {
+			d.add(path, "values differ", jsonValue(expected), jsonValue(actual))
+		}
+	}
+}
+
+func (d *jsonDiff) add(path, message string, expected, actual json.RawMessage) {
+	if len(d.differences) == maxDifferences {
+		d.differences = append(d.differences, Difference{Message: "too many differences, the following ones are left out"})
+	}
+	if len(d.differences) > maxDifferences {
+		return
+	}
+	d.differences = append(d.differences, Difference{Path: path, Message: message, Expected: expected, Actual: actual})
+}
+
+func (d *jsonDiff) ignored(path string) bool {
+	for _, ignored := range d.ignorePaths {
+		if path == ignored || strings.HasPrefix(path, ignored+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// jsonValue encodes a decoded value, null included
+func jsonValue(value any) json.RawMessage {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil
+	}
+	return encoded
+}
+
+// jsonType returns the JSON type of a decoded value
+func jsonType(value any) string {
+	switch value.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	default:
+		return "null"
+	}
+}
+
+// escapePointer escapes a key of an object in a JSON pointer
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
@@ -0,0 +1,160 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/epos-eu/converter-service/dao/model"
+)
+
+func TestCompareOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture model.PluginFixture
+		output  string
+		// the differences as they are reported
+		want string
+	}{
+		{
+			name:    "key order",
+			fixture: model.PluginFixture{Compare: model.CompareJSON, Expected: `{"a": 1, "b": {"c": "x", "d": true}}`},
+			output:  `{"b": {"d": true, "c": "x"}, "a": 1}`,
+			want:    `[]`,
+		},
+		{
+			name:    "number formatting",
+			fixture: model.PluginFixture{Compare: model.CompareJSON, Expected: `[1, 1.0, 1e0, 100]`},
+			output:  `[1.0, 1e0, 1, 1e2]`,
+			want:    `[]`,
+		},
+		{
+			name:    "different numbers",
+			fixture: model.PluginFixture{Compare: model.CompareJSON, Expected: `{"v": 1}`},
+			output:  `{"v": 1.5}`,
+			want:    `[{"path":"/v","message":"values differ","expected":1,"actual":1.5}]`,
+		},
+		{
+			name:    "numbers within the tolerance",
+			fixture: model.PluginFixture{Compare: model.CompareJSON, Expected: `{"v": 1, "w": 2}`, Tolerance: 0.01},
+			output:  `{"v": 1.005, "w": 2.02}`,
+			want:    `[{"path":"/w","message":"values differ","expected":2,"actual":2.02}]`,
+		},
+		{
+			name:    "nested arrays",
+			fixture: model.PluginFixture{Compare: model.CompareJSON, Expected: `{"a": [[1, 2], [3, [4, 5]]]}`},
+			output:  `{"a": [[1, 2], [3, [4, 6]], []]}`,
+			want: `[{"path":"/a","message":"expected 2 items, got 3"},` +
+				`{"path":"/a/1/1/1","message":"values differ","expected":5,"actual":6}]`,
+		},
+		{
+			name:    "missing and extra keys",
+			fixture: model.PluginFixture{Compare: model.CompareJSON, Expected: `{"a": 1, "b": {"c": [1]}}`},
+			output:  `{"a": 1, "b": {}, "d/e": "x"}`,
+			want: `[{"path":"/b/c","message":"missing","expected":[1]},` +
+				`{"path":"/d~1e","message":"unexpected","actual":"x"}]`,
+		},
+		{
+			name:    "null",
+			fixture: model.PluginFixture{Compare: model.CompareJSON, Expected: `{"a": null, "b": 1, "c": null, "d": null}`},
+			output:  `{"a": null, "b": null, "c": 0, "e": null}`,
+			want: `[{"path":"/b","message":"expected number, got null","expected":1,"actual":null},` +
+				`{"path":"/c","message":"expected null, got number","expected":null,"actual":0},` +
+				`{"path":"/d","message":"missing","expected":null},` +
+				`{"path":"/e","message":"unexpected","actual":null}]`,
+		},
+		{
+			name:    "type mismatch",
+			fixture: model.PluginFixture{Compare: model.CompareJSON, Expected: `{"a": {"b": 1}, "c": [1], "d": "1"}`},
+			output:  `{"a": [1], "c": {"b": 1}, "d": 1}`,
+			want: `[{"path":"/a","message":"expected object, got array","actual":[1]},` +
+				`{"path":"/c","message":"expected array, got object","actual":{"b":1}},` +
+				`{"path":"/d","message":"expected string, got number","expected":"1","actual":1}]`,
+		},
+		{
+			name: "ignored paths",
+			fixture: model.PluginFixture{
+				Compare:     model.CompareJSON,
+				Expected:    `{"metadata": {"generatedAt": "2024-01-01", "version": 1}, "data": [1]}`,
+				IgnorePaths: []string{"/metadata/generatedAt", "/extra"},
+			},
+			output: `{"metadata": {"generatedAt": "2025-06-30", "version": 1}, "data": [1], "extra": {"a": 1}}`,
+			want:   `[]`,
+		},
+		{
+			name:    "non-JSON output",
+			fixture: model.PluginFixture{Compare: model.CompareJSON, Expected: "{\n  \"a\": 1\n}"},
+			output:  "{\n  \"a\": 1\nWARNING: something went wrong",
+			want:    `[{"path":"","message":"the output is not valid JSON, the output differs from line 3 (3 lines expected, 3 written)","expected":"}","actual":"WARNING: something went wrong"}]`,
+		},
+		{
+			name:    "invalid expected output",
+			fixture: model.PluginFixture{Compare: model.CompareJSON, Expected: `{"a":`},
+			output:  `{"a": 1}`,
+			want:    `[{"path":"","message":"the expected output is not valid JSON: unexpected end of JSON input"}]`,
+		},
+		{
+			name:    "exact",
+			fixture: model.PluginFixture{Compare: model.CompareExact, Expected: "a,b\n1,2\n"},
+			output:  "\na,b\n1,2",
+			want:    `[]`,
+		},
+		{
+			name:    "exact with a different line",
+			fixture: model.PluginFixture{Compare: model.CompareExact, Expected: "a,b\n1,2\n3,4"},
+			output:  "a,b\n1,3\n3,4",
+			want:    `[{"path":"","message":"the output differs from line 2 (3 lines expected, 3 written)","expected":"1,2","actual":"1,3"}]`,
+		},
+		{
+			name:    "exact with missing lines",
+			fixture: model.PluginFixture{Compare: model.CompareExact, Expected: "a,b\n1,2\n"},
+			output:  "a,b",
+			want:    `[{"path":"","message":"the output differs from line 2 (2 lines expected, 1 written)","expected":"1,2"}]`,
+		},
+		{
+			name:    "exact with extra lines",
+			fixture: model.PluginFixture{Compare: model.CompareExact, Expected: "a,b"},
+			output:  "a,b\n1,2",
+			want:    `[{"path":"","message":"the output differs from line 2 (1 lines expected, 2 written)","actual":"1,2"}]`,
+		},
+		{
+			name:    "exact with an extra empty line",
+			fixture: model.PluginFixture{Compare: model.CompareExact, Expected: "a,b\n1,2"},
+			output:  "a,b\n\n1,2",
+			want:    `[{"path":"","message":"the output differs from line 2 (2 lines expected, 3 written)","expected":"1,2","actual":""}]`,
+		},
+		{
+			name:    "exact does not parse JSON",
+			fixture: model.PluginFixture{Compare: model.CompareExact, Expected: `{"a": 1}`},
+			output:  `{"a": 1.0}`,
+			want:    `[{"path":"","message":"the output differs from line 1 (1 lines expected, 1 written)","expected":"{\"a\": 1}","actual":"{\"a\": 1.0}"}]`,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := json.Marshal(compareOutput(test.fixture, []byte(test.output)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestCompareOutputTooManyDifferences(t *testing.T) {
+	items := make([]string, maxDifferences+10)
+	for i := range items {
+		items[i] = fmt.Sprint(i)
+	}
+	fixture := model.PluginFixture{Compare: model.CompareJSON, Expected: "[" + strings.Join(items, ",") + "]"}
+	got := compareOutput(fixture, []byte("["+strings.Repeat("-1,", len(items)-1)+"-1]"))
+	if len(got) != maxDifferences+1 {
+		t.Fatalf("got %d differences, want %d", len(got), maxDifferences+1)
+	}
+	if last := got[maxDifferences]; last.Path != "" || !strings.HasPrefix(last.Message, "too many differences") {
+		t.Errorf("got %+v as the last difference", last)
+	}
+}
@@ -1,19 +1,49 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"os/exec"
-	"path/filepath"
+	"time"
 
-	"github.com/epos-eu/converter-service/db"
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/internal/env"
 	"github.com/epos-eu/converter-service/logging"
+	"github.com/epos-eu/converter-service/metrics"
+	"github.com/epos-eu/converter-service/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-var log = logging.Get("default")
+var (
+	log            = logging.Get("handler")
+	tracer         = tracing.Tracer("handler")
+	defaultTimeout = 5 * time.Minute
+)
+
+func init() {
+	defaultTimeout = time.Duration(env.Int("PLUGIN_TIMEOUT", int(defaultTimeout.Seconds()))) * time.Second
+}
+
+// pluginTimeout returns the timeout of the plugin, falling back to the service default when it has none
+func pluginTimeout(plugin model.Plugin) time.Duration {
+	if plugin.Timeout > 0 {
+		return time.Duration(plugin.Timeout) * time.Second
+	}
+	return defaultTimeout
+}
 
-func ExternalAccessHandler(bytes []byte) ([]byte, error) {
+// ExternalAccessHandler converts the payload of a message of the map queue, with its plugin or pipeline
+func ExternalAccessHandler(ctx context.Context, bytes []byte) ([]byte, error) {
+	ctx, span := tracer.Start(ctx, "ExternalAccessHandler")
+	response, err := externalAccess(ctx, bytes)
+	tracing.End(span, err)
+	return response, err
+}
+
+func externalAccess(ctx context.Context, bytes []byte) ([]byte, error) {
 	body := string(bytes)
 
 	var message Message
@@ -21,23 +51,76 @@ func ExternalAccessHandler(bytes []byte) ([]byte, error) {
 	log.Debug("Handling message", "message", body)
 
 	if err := json.Unmarshal([]byte(body), &message); err != nil {
-		return nil, fmt.Errorf("error converting payload: %v", err)
+		return nil, newError(CodeBadMessage, "", fmt.Errorf("error converting payload: %v", err))
 	}
 
 	// validate the message
 	if message.Payload == "" {
-		return nil, fmt.Errorf("error getting the payload: the payload is empty")
+		return nil, newError(CodeBadMessage, message.Parameters.PluginID, fmt.Errorf("error getting the payload: the payload is empty"))
+	}
+	if message.Parameters.DistributionID == "" {
+		return nil, newError(CodeBadMessage, message.Parameters.PluginID, fmt.Errorf("error: the distributionId must be specified. pluginId: %s", message.Parameters.PluginID))
 	}
-	// both the distributionId and the pluginId must be specified
-	if message.Parameters.DistributionID == "" || message.Parameters.PluginID == "" {
-		return nil, fmt.Errorf("error: both the distributionId and the pluginId must be specified. distributionId: %s. pluginId: %s", message.Parameters.DistributionID, message.Parameters.PluginID)
+	if message.Parameters.PluginID != "" && message.Parameters.PipelineID != "" {
+		return nil, newError(CodeBadMessage, message.Parameters.PluginID, fmt.Errorf("error: only one of the pluginId and the pipelineId can be specified. pluginId: %s. pipelineId: %s", message.Parameters.PluginID, message.Parameters.PipelineID))
+	}
+	// without a pluginId or a pipelineId, the conversion is selected from the relations of the distribution
+	if message.Parameters.PluginID == "" && message.Parameters.PipelineID == "" {
+		_, span := tracer.Start(ctx, "selectRelation")
+		relation, err := selectRelation(message.Parameters.DistributionID, message.Parameters.RequestFormat, message.Parameters.ResponseFormat)
+		tracing.End(span, err)
+		if errors.Is(err, ErrNoMatchingPlugin) || errors.Is(err, ErrAmbiguousPlugin) {
+			return nil, newError(CodePluginNotFound, "", fmt.Errorf("error selecting the plugin: %w", err))
+		}
+		if err != nil {
+			return nil, newError(CodeInternal, "", fmt.Errorf("error selecting the plugin: %w", err))
+		}
+		log.Debug("conversion selected",
+			"plugin_id", relation.PluginID,
+			"pipeline_id", relation.PipelineID,
+			"distribution_id", message.Parameters.DistributionID,
+			"request_content_type", message.Parameters.RequestFormat,
+			"response_content_type", message.Parameters.ResponseFormat)
+		message.Parameters.PluginID = relation.PluginID.String()
+		message.Parameters.PipelineID = relation.PipelineID.String()
 	}
 
-	plugin, err := db.GetPluginByID(message.Parameters.PluginID)
+	var output []byte
+	var err error
+	// the plugin that wrote the output, the last step of a pipeline
+	pluginID := message.Parameters.PluginID
+	if message.Parameters.PipelineID != "" {
+		output, pluginID, err = runPipeline(ctx, message.Parameters.PipelineID, message.Payload, message.Parameters)
+	} else {
+		output, err = executePlugin(ctx, message.Parameters.PluginID, message.Payload, message.Parameters)
+	}
+	if err != nil {
+		return nil, err
+	}
+	response, err := wrapOutput(output)
 	if err != nil {
-		return nil, fmt.Errorf("error getting plugins: %v", err)
+		return nil, newError(CodeInvalidOutput, pluginID, err)
 	}
+	return response, nil
+}
 
+// executePlugin runs the plugin on the payload within the timeout of the plugin and returns its raw output
+func executePlugin(ctx context.Context, pluginID, payload string, parameters Parameters) ([]byte, error) {
+	_, span := tracer.Start(ctx, "db.GetPluginByID")
+	plugin, err := store.GetPluginByID(pluginID)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, notFoundOr(pluginID, fmt.Errorf("error getting plugins: %w", err))
+	}
+	if !plugin.Enabled {
+		return nil, newError(CodePluginDisabled, plugin.ID, fmt.Errorf("plugin %s is disabled", plugin.ID))
+	}
+	return runPluginWithTimeout(ctx, plugin, payload, parameters)
+}
+
+// runPluginWithTimeout runs the plugin on the payload within the timeout of the plugin and returns its raw output
+func runPluginWithTimeout(ctx context.Context, plugin model.Plugin, payload string, parameters Parameters) (output []byte, err error) {
+	timeout := pluginTimeout(plugin)
 	log.Info("executing plugin",
 		slog.Group("plugin",
 			"id", plugin.ID,
@@ -45,42 +128,74 @@ func ExternalAccessHandler(bytes []byte) ([]byte, error) {
 			"version", plugin.Version,
 			"version type", plugin.VersionType,
 			"runtime", plugin.Runtime,
-			"arguments", plugin.Arguments))
-
-	switch plugin.Runtime {
-	case "java":
+			"arguments", plugin.Arguments,
+			"timeout", timeout))
 
-		cmd := exec.Command("java",
-			// Options needed for the EPOS-GEO-JSON library
-			"--add-opens=java.base/java.util=ALL-UNNAMED",
-			"--add-opens=java.base/sun.reflect.annotation=ALL-UNNAMED",
-
-			"-cp",
-			"./plugins/"+plugin.ID+"/"+plugin.Executable,
-			plugin.Arguments)
+	ctx, span := tracer.Start(ctx, "runPlugin", trace.WithAttributes(
+		attribute.String("plugin.id", plugin.ID),
+		attribute.String("plugin.runtime", string(plugin.Runtime)),
+		attribute.String("plugin.protocol", string(plugin.Protocol)),
+	))
+	// the test runs bring their own report
+	process, ok := ctx.Value(processReportKey{}).(*processReport)
+	if !ok {
+		process = &processReport{}
+		ctx = context.WithValue(ctx, processReportKey{}, process)
+	}
+	ctx, release := trackExecution(ctx, process.test)
+	defer release()
+	start := time.Now()
+	inflight := metrics.InflightExecutions.WithLabelValues(plugin.ID)
+	if process.test {
+		inflight = metrics.InflightTestRuns.WithLabelValues(plugin.ID)
+	}
+	inflight.Inc()
+	defer func() {
+		inflight.Dec()
+		recordConversion(ctx, plugin, len(payload), output, err, time.Since(start))
+		if !process.test {
+			recordExecution(ctx, plugin, parameters, len(payload), output, err, start, process.stderrTail)
+		}
+		tracing.End(span, err)
+	}()
 
-		return executeCommand(message.Payload, cmd)
-	case "python":
-		cmd := exec.Command("venv/bin/python", plugin.Executable)
-		cmd.Dir = filepath.Join("./plugins", plugin.ID)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
 
-		return executeCommand(message.Payload, cmd)
-	case "go", "binary":
-		cmd := exec.Command("./plugins/" + plugin.ID + "/" + plugin.Executable)
+	output, err = runPlugin(ctx, plugin, payload, parameters)
+	if err != nil && errors.Is(context.Cause(ctx), ErrShuttingDown) {
+		log.Error("plugin killed by the shutdown", "plugin_id", plugin.ID, "correlation_id", correlationID(ctx))
+		return nil, newError(CodeInternal, plugin.ID, fmt.Errorf("plugin %s was interrupted: %w", plugin.ID, ErrShuttingDown))
+	}
+	if errors.Is(err, ErrPluginTimeout) {
+		log.Error("plugin execution timed out", "plugin_id", plugin.ID, "correlation_id", correlationID(ctx), "timeout", timeout)
+		return nil, newError(CodeTimeout, plugin.ID, fmt.Errorf("plugin %s did not finish within %s: %w", plugin.ID, timeout, err))
+	}
+	if handlerErr, ok := errors.AsType[*Error](err); ok {
+		handlerErr.PluginID = plugin.ID
+		return nil, handlerErr
+	}
+	if err != nil {
+		return nil, newError(CodePluginFailed, plugin.ID, err)
+	}
+	return output, nil
+}
 
-		return executeCommand(message.Payload, cmd)
-	default:
-		log.Error("unknown runtime", "plugin runtime", plugin.Runtime)
-		response, err := json.Marshal("{}")
-		if err != nil {
-			return nil, fmt.Errorf("error on creating json: %v", err)
-		}
-		return response, nil
+// runPlugin runs the plugin on the payload with its runtime and the protocol it declares, and returns its raw output
+func runPlugin(ctx context.Context, plugin model.Plugin, payload string, parameters Parameters) ([]byte, error) {
+	runtime, err := pluginRuntime(plugin)
+	if err != nil {
+		return nil, err
+	}
+	if plugin.Protocol == model.ProtocolWorker {
+		return runWorkerJob(ctx, runtime, plugin, payload, parameters)
 	}
+	return executeCommand(ctx, runtime, plugin, payload)
 }
 
 type relation struct {
-	PluginID     string `json:"pluginId"`
+	PluginID     string `json:"pluginId,omitempty"`
+	PipelineID   string `json:"pipelineId,omitempty"`
 	InputFormat  string `json:"inputFormat"`
 	OutputFormat string `json:"outputFormat"`
 }
@@ -94,23 +209,53 @@ type resourcesMsg struct {
 	Plugins string `json:"plugins"`
 }
 
-func ResourcesServiceHandler(bytes []byte) ([]byte, error) {
+// ResourcesServiceHandler lists the conversions available for each distribution, for a message of the resources queue
+func ResourcesServiceHandler(ctx context.Context, bytes []byte) ([]byte, error) {
+	_, span := tracer.Start(ctx, "ResourcesServiceHandler")
+	response, err := resourcesService(bytes)
+	tracing.End(span, err)
+	return response, err
+}
+
+func resourcesService(bytes []byte) ([]byte, error) {
 	var resourcesMsg resourcesMsg
-	err := json.Unmarshal(bytes, &resourcesMsg)
-	if err != nil || resourcesMsg.Plugins != "all" {
-		return nil, fmt.Errorf("failed to process the message: %w", err)
+	if err := json.Unmarshal(bytes, &resourcesMsg); err != nil {
+		return nil, newError(CodeBadMessage, "", fmt.Errorf("failed to process the message: %w", err))
+	}
+	if resourcesMsg.Plugins != "all" {
+		return nil, newError(CodeBadMessage, "", fmt.Errorf("failed to process the message: unsupported plugins value %q", resourcesMsg.Plugins))
 	}
 
 	// get all plugin relations
-	relations, err := db.GetPluginRelationForEnabledPlugins()
+	relations, err := store.GetPluginRelationForEnabledPlugins()
 	if err != nil {
-		return nil, fmt.Errorf("failed to get plugin relations: %w", err)
+		return nil, newError(CodeInternal, "", fmt.Errorf("failed to get plugin relations: %w", err))
+	}
+	// and the relations pointing at the pipelines whose plugins are all enabled and installed
+	pipelineRelations, err := store.GetPipelineRelations()
+	if err != nil {
+		return nil, newError(CodeInternal, "", fmt.Errorf("failed to get pipeline relations: %w", err))
+	}
+	availablePipelines := make(map[model.NullableID]bool)
+	for _, r := range pipelineRelations {
+		available, ok := availablePipelines[r.PipelineID]
+		if !ok {
+			available, err = pipelineAvailable(r.PipelineID.String())
+			if err != nil {
+				return nil, newError(CodeInternal, "", fmt.Errorf("failed to check pipeline %s: %w", r.PipelineID, err))
+			}
+			availablePipelines[r.PipelineID] = available
+		}
+		if available {
+			relations = append(relations, r)
+		}
 	}
 	// group them by OperationID
 	operations := make(map[string][]relation)
 	for _, r := range relations {
 		operations[r.RelationID] = append(operations[r.RelationID], relation{
-			PluginID:     r.PluginID,
+			PluginID:     r.PluginID.String(),
+			PipelineID:   r.PipelineID.String(),
 			InputFormat:  r.InputFormat,
 			OutputFormat: r.OutputFormat,
 		})
@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/db"
+	"github.com/epos-eu/converter-service/internal/env"
+	"github.com/google/uuid"
+)
+
+// the longest error message kept in the execution history
+const errorMessageLength = 1024
+
+var (
+	executionHistory     = true
+	executionRetention   = 30 * 24 * time.Hour
+	executionPurgePeriod = time.Hour
+)
+
+func init() {
+	executionHistory = env.Get("EXECUTION_HISTORY", "true") == "true"
+	executionRetention = time.Duration(env.Int("EXECUTION_RETENTION_DAYS", int(executionRetention.Hours()/24))) * 24 * time.Hour
+}
+
+// recordExecution records an execution of the plugin in the execution history, test runs are left out by the caller
+func recordExecution(ctx context.Context, plugin model.Plugin, parameters Parameters, payloadSize int, output []byte, err error, start time.Time, stderr string) {
+	if !executionHistory {
+		return
+	}
+
+	finish := time.Now()
+	execution := model.Execution{
+		ID:             uuid.NewString(),
+		CorrelationID:  correlationID(ctx),
+		DistributionID: parameters.DistributionID,
+		PluginID:       plugin.ID,
+		PluginVersion:  plugin.Version,
+		PipelineID:     parameters.PipelineID,
+		PipelineStep:   pipelineStep(ctx),
+		Runtime:        string(plugin.Runtime),
+		StartedAt:      start,
+		FinishedAt:     finish,
+		DurationMs:     finish.Sub(start).Milliseconds(),
+		Outcome:        model.ExecutionSucceeded,
+		PayloadSize:    int64(payloadSize),
+		OutputSize:     int64(len(output)),
+		Stderr:         sanitizeText(stderr),
+	}
+	if err != nil {
+		execution.Outcome = model.ExecutionFailed
+		execution.ErrorCode = string(CodeInternal)
+		if handlerErr, ok := errors.AsType[*Error](err); ok {
+			execution.ErrorCode = string(handlerErr.Code)
+		}
+		message := errorMessage(err)
+		if len(message) > errorMessageLength {
+			message = message[:errorMessageLength]
+		}
+		execution.ErrorMessage = sanitizeText(message)
+		execution.OutputSize = 0
+	}
+
+	if err := store.CreateExecution(execution); err != nil {
+		log.Error("error recording the execution", "plugin_id", plugin.ID, "correlation_id", execution.CorrelationID, "error", err)
+	}
+}
+
+// sanitizeText makes s storable in a text column, Postgres rejects invalid UTF-8 and NUL characters
+func sanitizeText(s string) string {
+	return strings.ReplaceAll(strings.ToValidUTF8(s, "�"), "\x00", "")
+}
+
+// StartExecutionPurge deletes the executions older than EXECUTION_RETENTION_DAYS at startup, then every
+// executionPurgePeriod until ctx is done. The executions are kept forever when it is 0.
+func StartExecutionPurge(ctx context.Context) {
+	if executionRetention <= 0 {
+		log.Info("execution history retention disabled, the executions are kept forever")
+		return
+	}
+
+	go func() {
+		purgeExecutions()
+		ticker := time.NewTicker(executionPurgePeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				purgeExecutions()
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// purgeExecutions deletes the executions older than the retention
+func purgeExecutions() {
+	purged, err := db.DeleteExecutionsBefore(time.Now().Add(-executionRetention))
+	if err != nil {
+		log.Error("error purging the execution history", "error", err)
+	} else if purged > 0 {
+		log.Info("old executions purged", "count", purged)
+	}
+}
@@ -0,0 +1,192 @@
+package handler
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/internal/env"
+	"github.com/epos-eu/converter-service/launcher"
+)
+
+const mib = 1024 * 1024
+
+var (
+	// the limits used for the plugins of each runtime when the plugin does not set its own, set by RegisterRuntime
+	runtimeLimits = map[model.SupportedRuntimes]model.ResourceLimits{}
+	defaultLimits model.ResourceLimits
+	launcherPath  string
+)
+
+func init() {
+	defaultLimits = limitsFromEnv("PLUGIN_", model.ResourceLimits{})
+
+	launcherPath = os.Getenv("PLUGIN_LAUNCHER")
+	if launcherPath == "" {
+		// by default the launcher is installed next to the service binary
+		executable, err := os.Executable()
+		if err != nil {
+			log.Warn("can't find the service executable to locate the plugin launcher", "error", err)
+			return
+		}
+		launcherPath = filepath.Join(filepath.Dir(executable), "plugin-launcher")
+	}
+}
+
+func limitsFromEnv(prefix string, defaults model.ResourceLimits) model.ResourceLimits {
+	return model.ResourceLimits{
+		MemoryMB:   env.Int(prefix+"MEMORY_MB", defaults.MemoryMB),
+		CPUSeconds: env.Int(prefix+"CPU_SECONDS", defaults.CPUSeconds),
+		FileSizeMB: env.Int(prefix+"FILE_SIZE_MB", defaults.FileSizeMB),
+		OpenFiles:  env.Int(prefix+"OPEN_FILES", defaults.OpenFiles),
+	}
+}
+
+// pluginLimits returns the limits of the plugin, with the unset ones taken from its runtime and then from the defaults
+func pluginLimits(plugin model.Plugin) model.ResourceLimits {
+	return plugin.Limits.Or(runtimeLimits[plugin.Runtime]).Or(defaultLimits)
+}
+
+// LimitError is returned when a plugin breaks one of its resource limits
+type LimitError struct {
+	// the limit that was exceeded (memory, cpu time, file size, open files)
+	Limit string
+	// the configured value of the limit
+	Value string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("plugin exceeded its %s limit of %s", e.Limit, e.Value)
+}
+
+// limitGuard enforces the limits of a plugin process
+type limitGuard struct {
+	limits model.ResourceLimits
+	cgroup *cgroup
+	// the number of jobs the process may run, the CPU time limit applies to each of them
+	jobs int
+	// set when the process was killed for going over the CPU time limit in one of its jobs
+	cpuExceeded atomic.Bool
+}
+
+// applyLimits configures cmd so that the plugin runs within limits, adding to spec the limits the launcher has to set.
+// The process gets the CPU time of jobs jobs, the one of each job is enforced by the caller (see jobCPU). The returned
+// guard must be released once the plugin has exited.
+func applyLimits(cmd *exec.Cmd, spec *launcher.Spec, name string, limits model.ResourceLimits, jobs int) *limitGuard {
+	guard := &limitGuard{limits: limits, jobs: max(jobs, 1)}
+	if limits.IsZero() {
+		return guard
+	}
+
+	var rlimits []launcher.Rlimit
+	if limits.MemoryMB > 0 {
+		// prefer a cgroup, that limits the resident memory of the whole process tree. The address space limit is only a
+		// fallback as it also counts memory that is reserved but never used (the JVM reserves a lot of it)
+		cg, err := newCgroup(name, uint64(limits.MemoryMB)*mib)
+		if err != nil {
+			log.Debug("cgroup not available, limiting the address space instead", "error", err)
+			rlimits = append(rlimits, rlimit(syscall.RLIMIT_AS, uint64(limits.MemoryMB)*mib))
+		} else {
+			guard.cgroup = cg
+			cg.attach(cmd)
+		}
+	}
+	if limits.CPUSeconds > 0 {
+		// SIGXCPU at the soft limit, SIGKILL one second later if the plugin handles it
+		budget := uint64(guard.cpuBudget() / time.Second)
+		rlimits = append(rlimits, launcher.Rlimit{
+			Resource: syscall.RLIMIT_CPU,
+			Cur:      budget,
+			Max:      budget + 1,
+		})
+	}
+	if limits.FileSizeMB > 0 {
+		rlimits = append(rlimits, rlimit(syscall.RLIMIT_FSIZE, uint64(limits.FileSizeMB)*mib))
+	}
+	if limits.OpenFiles > 0 {
+		rlimits = append(rlimits, rlimit(syscall.RLIMIT_NOFILE, uint64(limits.OpenFiles)))
+	}
+
+	spec.Rlimits = append(spec.Rlimits, rlimits...)
+	return guard
+}
+
+func rlimit(resource int, value uint64) launcher.Rlimit {
+	return launcher.Rlimit{Resource: resource, Cur: value, Max: value}
+}
+
+// jobCPU returns the CPU time limit of a single job, zero if there is none
+func (g *limitGuard) jobCPU() time.Duration {
+	return time.Duration(g.limits.CPUSeconds) * time.Second
+}
+
+// cpuBudget returns the CPU time limit of the whole life of the process
+func (g *limitGuard) cpuBudget() time.Duration {
+	return g.jobCPU() * time.Duration(max(g.jobs, 1))
+}
+
+// cpuTime returns the CPU time used so far by the plugin process started with pid, or by its whole cgroup if it has one
+func (g *limitGuard) cpuTime(pid int) (time.Duration, error) {
+	if g.cgroup != nil {
+		return g.cgroup.cpuTime()
+	}
+	return processCPUTime(pid)
+}
+
+// check returns a *LimitError if the plugin that exited with state, after writing stderr, was stopped by one of the
+// limits. Going over the memory limit is only reported when it is enforced with a cgroup, from its oom_kill events.
+func (g *limitGuard) check(state *os.ProcessState, stderr string) error {
+	if g.cgroup != nil && g.cgroup.oomKilled() {
+		return &LimitError{Limit: "memory", Value: fmt.Sprintf("%d MiB", g.limits.MemoryMB)}
+	}
+	if g.cpuExceeded.Load() {
+		return &LimitError{Limit: "cpu time", Value: fmt.Sprintf("%d seconds", g.limits.CPUSeconds)}
+	}
+	if state == nil || state.Success() {
+		return nil
+	}
+	status, ok := state.Sys().(syscall.WaitStatus)
+	if !ok {
+		return nil
+	}
+
+	// running out of file descriptors doesn't kill the plugin, it fails on its own
+	if g.limits.OpenFiles > 0 && strings.Contains(stderr, "Too many open files") {
+		return &LimitError{Limit: "open files", Value: strconv.Itoa(g.limits.OpenFiles)}
+	}
+
+	var signal syscall.Signal
+	switch {
+	case status.Signaled():
+		signal = status.Signal()
+	case status.ExitStatus() > 128:
+		// the plugin is a wrapper (a shell script for example) whose child was killed by the signal
+		signal = syscall.Signal(status.ExitStatus() - 128)
+	default:
+		return nil
+	}
+
+	cpuTime := state.UserTime() + state.SystemTime()
+	switch {
+	case signal == syscall.SIGXCPU,
+		signal == syscall.SIGKILL && g.limits.CPUSeconds > 0 && cpuTime >= g.cpuBudget():
+		return &LimitError{Limit: "cpu time", Value: fmt.Sprintf("%d seconds", g.limits.CPUSeconds)}
+	case signal == syscall.SIGXFSZ:
+		return &LimitError{Limit: "file size", Value: fmt.Sprintf("%d MiB", g.limits.FileSizeMB)}
+	}
+	return nil
+}
+
+// release frees the resources used to enforce the limits
+func (g *limitGuard) release() {
+	if g.cgroup != nil {
+		g.cgroup.remove()
+	}
+}
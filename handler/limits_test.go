@@ -0,0 +1,92 @@
+package handler
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/launcher"
+)
+
+// exitState runs the shell script and returns how it exited
+func exitState(t *testing.T, script string) *os.ProcessState {
+	t.Helper()
+	cmd := exec.Command("sh", "-c", script)
+	if err := cmd.Run(); err != nil {
+		if _, ok := errors.AsType[*exec.ExitError](err); !ok {
+			t.Fatal(err)
+		}
+	}
+	return cmd.ProcessState
+}
+
+func TestLimitGuardCheck(t *testing.T) {
+	limits := model.ResourceLimits{MemoryMB: 64, CPUSeconds: 10, FileSizeMB: 1, OpenFiles: 16}
+	tests := []struct {
+		name   string
+		limits model.ResourceLimits
+		script string
+		stderr string
+		// the limit reported, empty when the failure is not caused by a limit
+		want string
+	}{
+		{name: "success", limits: limits, script: "exit 0"},
+		{name: "plain failure", limits: limits, script: "exit 1", stderr: "invalid input"},
+		{name: "cpu time signal", limits: limits, script: "kill -XCPU $$", want: "cpu time"},
+		{name: "cpu time signal of a child", limits: limits, script: "exit " + strconv.Itoa(128+int(syscall.SIGXCPU)), want: "cpu time"},
+		{name: "killed before the cpu time limit", limits: limits, script: "kill -KILL $$"},
+		{name: "file size signal", limits: limits, script: "kill -XFSZ $$", want: "file size"},
+		{name: "too many open files", limits: limits, script: "exit 1", stderr: "open input: Too many open files", want: "open files"},
+		{name: "too many open files without a limit", script: "exit 1", stderr: "open input: Too many open files"},
+		{name: "out of memory without a cgroup", limits: limits, script: "exit 1", stderr: "java.lang.OutOfMemoryError: Java heap space"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			guard := &limitGuard{limits: test.limits}
+			err := guard.check(exitState(t, test.script), test.stderr)
+			limitErr, ok := errors.AsType[*LimitError](err)
+			switch {
+			case test.want == "" && err != nil:
+				t.Errorf("got %v, want no limit error", err)
+			case test.want != "" && !ok:
+				t.Errorf("got %v, want the %s limit", err, test.want)
+			case ok && limitErr.Limit != test.want:
+				t.Errorf("got the %s limit, want the %s limit", limitErr.Limit, test.want)
+			}
+		})
+	}
+}
+
+func TestLimitGuardCheckWorker(t *testing.T) {
+	limits := model.ResourceLimits{CPUSeconds: 1}
+
+	// a worker killed by the service during a job that went over the CPU time limit
+	guard := &limitGuard{limits: limits, jobs: 100}
+	guard.cpuExceeded.Store(true)
+	err := guard.check(exitState(t, "kill -KILL $$"), "")
+	if limitErr, ok := errors.AsType[*LimitError](err); !ok || limitErr.Limit != "cpu time" {
+		t.Errorf("got %v, want the cpu time limit", err)
+	}
+
+	// a worker killed for another reason, far from the CPU time of its jobs
+	guard = &limitGuard{limits: limits, jobs: 100}
+	if err := guard.check(exitState(t, "kill -KILL $$"), ""); err != nil {
+		t.Errorf("got %v, want no limit error", err)
+	}
+}
+
+func TestLimitGuardCPUBudget(t *testing.T) {
+	var spec launcher.Spec
+	guard := applyLimits(exec.Command("true"), &spec, "test", model.ResourceLimits{CPUSeconds: 3}, 10)
+	if guard.jobCPU() != 3*time.Second || guard.cpuBudget() != 30*time.Second {
+		t.Errorf("got %s per job and %s in total, want 3s and 30s", guard.jobCPU(), guard.cpuBudget())
+	}
+	if len(spec.Rlimits) != 1 || spec.Rlimits[0].Cur != 30 {
+		t.Errorf("got the rlimits %+v, want a CPU time limit of 30 seconds", spec.Rlimits)
+	}
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/metrics"
+)
+
+// recordConversion records an execution of the plugin in the metrics of the conversions, test runs are left out
+func recordConversion(ctx context.Context, plugin model.Plugin, payloadSize int, output []byte, err error, duration time.Duration) {
+	if report, ok := ctx.Value(processReportKey{}).(*processReport); ok && report.test {
+		return
+	}
+
+	outcome := "success"
+	if err != nil {
+		outcome = string(CodeInternal)
+		if handlerErr, ok := errors.AsType[*Error](err); ok {
+			outcome = string(handlerErr.Code)
+		}
+	}
+	metrics.Conversions.WithLabelValues(plugin.ID, string(plugin.Runtime), outcome).Inc()
+	metrics.PluginDuration.WithLabelValues(plugin.ID, string(plugin.Runtime)).Observe(duration.Seconds())
+	metrics.PayloadSize.WithLabelValues(plugin.ID).Observe(float64(payloadSize))
+	if err == nil {
+		metrics.OutputSize.WithLabelValues(plugin.ID).Observe(float64(len(output)))
+	}
+}
@@ -7,6 +7,7 @@ type Message struct {
 
 type Parameters struct {
 	PluginID       string `json:"pluginId,omitempty"`
+	PipelineID     string `json:"pipelineId,omitempty"`
 	DistributionID string `json:"distributionId"`
 	RequestFormat  string `json:"requestContentType,omitempty"`
 	ResponseFormat string `json:"responseContentType,omitempty"`
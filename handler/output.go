@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+
+	"github.com/epos-eu/converter-service/internal/env"
+)
+
+const (
+	// maximum length of a single logged line of plugin output
+	maxLineLength = 4096
+	// how much of the end of stderr is included in the error of a failed execution
+	stderrTailLength = 2048
+)
+
+var outputLimit = 64 * 1024
+
+func init() {
+	outputLimit = env.Int("PLUGIN_OUTPUT_LIMIT", outputLimit)
+}
+
+// tailBuffer keeps the last limit bytes written to it. It is safe for concurrent use, as the output of a worker is
+// read while the worker is still writing it.
+type tailBuffer struct {
+	mu    sync.Mutex
+	limit int
+	buf   []byte
+}
+
+func newTailBuffer(limit int) *tailBuffer {
+	return &tailBuffer{limit: limit}
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := len(p)
+	if len(p) >= b.limit {
+		b.buf = append(b.buf[:0], p[len(p)-b.limit:]...)
+		return n, nil
+	}
+	if over := len(b.buf) + len(p) - b.limit; over > 0 {
+		copy(b.buf, b.buf[over:])
+		b.buf = b.buf[:len(b.buf)-over]
+	}
+	b.buf = append(b.buf, p...)
+	return n, nil
+}
+
+// reset forgets what was written so far, e.g. the output of the previous jobs of a worker
+func (b *tailBuffer) reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = b.buf[:0]
+}
+
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
+
+// tail returns at most the last n bytes written, starting at a line boundary when possible
+func (b *tailBuffer) tail(n int) string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.buf) <= n {
+		return strings.TrimSpace(string(b.buf))
+	}
+	tail := b.buf[len(b.buf)-n:]
+	if i := bytes.IndexByte(tail, '\n'); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	}
+	return strings.TrimSpace(string(tail))
+}
+
+// lineLogger logs every line written to it as a record of the plugin output, up to limit bytes
+type lineLogger struct {
+	logger    *slog.Logger
+	level     slog.Level
+	limit     int
+	remaining int
+	partial   []byte
+}
+
+func newLineLogger(logger *slog.Logger, level slog.Level, limit int) *lineLogger {
+	return &lineLogger{logger: logger, level: level, limit: limit, remaining: limit}
+}
+
+func (l *lineLogger) Write(p []byte) (int, error) {
+	n := len(p)
+	if l.remaining <= 0 {
+		return n, nil
+	}
+	if len(p) > l.remaining {
+		p = p[:l.remaining]
+	}
+	l.remaining -= len(p)
+
+	l.partial = append(l.partial, p...)
+	for {
+		i := bytes.IndexByte(l.partial, '\n')
+		if i < 0 && len(l.partial) < maxLineLength {
+			break
+		}
+		if i < 0 || i > maxLineLength {
+			i = maxLineLength
+		}
+		l.log(l.partial[:i])
+		rest := l.partial[i:]
+		if len(rest) > 0 && rest[0] == '\n' {
+			rest = rest[1:]
+		}
+		l.partial = l.partial[:copy(l.partial, rest)]
+	}
+
+	if l.remaining <= 0 {
+		l.flush()
+		l.logger.Log(context.Background(), slog.LevelWarn, fmt.Sprintf("plugin output exceeded %d bytes, the rest is not logged", l.limit))
+	}
+	return n, nil
+}
+
+// flush logs the last line, if it was not terminated by a newline
+func (l *lineLogger) flush() {
+	if len(l.partial) > 0 {
+		l.log(l.partial)
+		l.partial = l.partial[:0]
+	}
+}
+
+func (l *lineLogger) log(line []byte) {
+	l.logger.Log(context.Background(), l.level, "plugin output", "line", string(line))
+}
@@ -0,0 +1,166 @@
+package handler
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestTailBuffer(t *testing.T) {
+	tests := []struct {
+		name   string
+		limit  int
+		writes []string
+		want   string
+	}{
+		{name: "under the limit", limit: 8, writes: []string{"abc", "def"}, want: "abcdef"},
+		{name: "exactly the limit", limit: 6, writes: []string{"abc", "def"}, want: "abcdef"},
+		{name: "wrap-around", limit: 8, writes: []string{"abcdef", "ghij", "kl"}, want: "efghijkl"},
+		{name: "write larger than the limit", limit: 4, writes: []string{"ab", "cdefghij"}, want: "ghij"},
+		{name: "empty write", limit: 4, writes: []string{"abc", ""}, want: "abc"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newTailBuffer(test.limit)
+			for _, w := range test.writes {
+				if n, err := b.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+			}
+			if got := b.String(); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestTailBufferReset(t *testing.T) {
+	b := newTailBuffer(8)
+	b.Write([]byte("first job"))
+	b.reset()
+	b.Write([]byte("second"))
+	if got := b.String(); got != "second" {
+		t.Errorf("got %q, want %q", got, "second")
+	}
+}
+
+func TestTailBufferTail(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		n       int
+		want    string
+	}{
+		{name: "shorter than n", content: "line 1\nline 2\n", n: 64, want: "line 1\nline 2"},
+		{name: "starts at a line boundary", content: "line 1\nline 2\nline 3\n", n: 10, want: "line 3"},
+		{name: "single long line", content: "abcdefghij", n: 4, want: "ghij"},
+		{name: "newline as last byte only", content: "abcdefghij\n", n: 4, want: "hij"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			b := newTailBuffer(1024)
+			b.Write([]byte(test.content))
+			if got := b.tail(test.n); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+// recordHandler keeps the messages and lines of the records it handles
+type recordHandler struct {
+	records *[]string
+}
+
+func (h recordHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h recordHandler) Handle(_ context.Context, r slog.Record) error {
+	record := r.Message
+	r.Attrs(func(a slog.Attr) bool {
+		if a.Key == "line" {
+			record += ": " + a.Value.String()
+		}
+		return true
+	})
+	*h.records = append(*h.records, record)
+	return nil
+}
+
+func (h recordHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+func (h recordHandler) WithGroup(string) slog.Handler      { return h }
+
+func TestLineLogger(t *testing.T) {
+	long := strings.Repeat("x", maxLineLength)
+	tests := []struct {
+		name   string
+		limit  int
+		writes []string
+		want   []string
+	}{
+		{
+			name:   "lines split across writes",
+			limit:  1024,
+			writes: []string{"first li", "ne\nsecond line\nthi", "rd line\n"},
+			want:   []string{"plugin output: first line", "plugin output: second line", "plugin output: third line"},
+		},
+		{
+			name:   "partial last line",
+			limit:  1024,
+			writes: []string{"done\nno newline"},
+			want:   []string{"plugin output: done", "plugin output: no newline"},
+		},
+		{
+			name:   "empty line",
+			limit:  1024,
+			writes: []string{"a\n\nb\n"},
+			want:   []string{"plugin output: a", "plugin output: ", "plugin output: b"},
+		},
+		{
+			name:   "line longer than the maximum length",
+			limit:  3 * maxLineLength,
+			writes: []string{long + "yz\n"},
+			want:   []string{"plugin output: " + long, "plugin output: yz"},
+		},
+		{
+			name:   "output over the limit",
+			limit:  10,
+			writes: []string{"12345\n", "6789\nabc\n", "more\n"},
+			want: []string{
+				"plugin output: 12345",
+				"plugin output: 6789",
+				"plugin output exceeded 10 bytes, the rest is not logged",
+			},
+		},
+		{
+			name:   "limit reached in the middle of a line",
+			limit:  8,
+			writes: []string{"12345\n6789"},
+			want: []string{
+				"plugin output: 12345",
+				"plugin output: 67",
+				"plugin output exceeded 8 bytes, the rest is not logged",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var records []string
+			l := newLineLogger(slog.New(recordHandler{records: &records}), slog.LevelInfo, test.limit)
+			for _, w := range test.writes {
+				if n, err := l.Write([]byte(w)); n != len(w) || err != nil {
+					t.Fatalf("Write(%q) = %d, %v", w, n, err)
+				}
+			}
+			l.flush()
+			if len(records) != len(test.want) {
+				t.Fatalf("got %d records %q, want %q", len(records), records, test.want)
+			}
+			for i := range records {
+				if records[i] != test.want[i] {
+					t.Errorf("record %d: got %q, want %q", i, records[i], test.want[i])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/internal/env"
+	"github.com/epos-eu/converter-service/tracing"
+	"gorm.io/gorm"
+)
+
+var (
+	defaultPipelineTimeout = 15 * time.Minute
+
+	// errPipelineTimeout is the cause of the context of a pipeline that did not finish within its timeout
+	errPipelineTimeout = errors.New("pipeline execution timed out")
+)
+
+func init() {
+	defaultPipelineTimeout = time.Duration(env.Int("PIPELINE_TIMEOUT", int(defaultPipelineTimeout.Seconds()))) * time.Second
+}
+
+// pipelineTimeout returns the timeout of the whole pipeline, falling back to the service default when it has none
+func pipelineTimeout(pipeline model.Pipeline) time.Duration {
+	if pipeline.Timeout > 0 {
+		return time.Duration(pipeline.Timeout) * time.Second
+	}
+	return defaultPipelineTimeout
+}
+
+// StepError is returned when a step of a pipeline fails
+type StepError struct {
+	PipelineID string
+	// the number of the step that failed, starting from 1
+	Step     int
+	Steps    int
+	PluginID string
+	// how long the step ran before failing
+	Duration time.Duration
+	Err      error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("step %d/%d of pipeline %s (plugin %s) failed after %s: %v", e.Step, e.Steps, e.PipelineID, e.PluginID, e.Duration, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// runPipeline runs the steps of the pipeline in order, each one on the output of the previous one, and returns the raw
+// output of the last one along with the plugin that wrote it. Each step runs within the timeout of its plugin, and the
+// whole pipeline within its own timeout. Each step is recorded in the execution history with its number.
+func runPipeline(ctx context.Context, pipelineID, payload string, parameters Parameters) ([]byte, string, error) {
+	_, span := tracer.Start(ctx, "db.GetPipelineByID")
+	pipeline, err := store.GetPipelineByID(pipelineID)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, "", notFoundOr("", fmt.Errorf("error getting pipeline: %w", err))
+	}
+
+	timeout := pipelineTimeout(pipeline)
+	pipelineLog := log.With("pipeline_id", pipeline.ID, "correlation_id", correlationID(ctx))
+	pipelineLog.Info("executing pipeline", "name", pipeline.Name, "steps", len(pipeline.Steps), "timeout", timeout)
+
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, errPipelineTimeout)
+	defer cancel()
+
+	start := time.Now()
+	input := []byte(payload)
+	pluginID := ""
+	for i, step := range pipeline.Steps {
+		stepParameters := parameters
+		stepParameters.PluginID = step.PluginID
+		stepParameters.RequestFormat = step.InputFormat
+		stepParameters.ResponseFormat = step.OutputFormat
+
+		stepStart := time.Now()
+		output, err := executePlugin(withPipelineStep(ctx, i+1), step.PluginID, string(input), stepParameters)
+		duration := time.Since(stepStart)
+		if err != nil && errors.Is(context.Cause(ctx), errPipelineTimeout) {
+			pipelineLog.Error("pipeline execution timed out", "step", i+1, "plugin_id", step.PluginID, "timeout", timeout)
+			err = newError(CodeTimeout, step.PluginID, fmt.Errorf("pipeline %s did not finish within %s: %w", pipeline.ID, timeout, errPipelineTimeout))
+		}
+		if err != nil {
+			pipelineLog.Error("pipeline step failed", "step", i+1, "plugin_id", step.PluginID, "duration", duration, "error", err)
+			return nil, "", &StepError{
+				PipelineID: pipeline.ID,
+				Step:       i + 1,
+				Steps:      len(pipeline.Steps),
+				PluginID:   step.PluginID,
+				Duration:   duration,
+				Err:        err,
+			}
+		}
+		pipelineLog.Info("pipeline step finished", "step", i+1, "plugin_id", step.PluginID, "duration", duration, "output_size", len(output))
+		input = output
+		pluginID = step.PluginID
+	}
+
+	pipelineLog.Info("pipeline finished", "duration", time.Since(start))
+	return input, pluginID, nil
+}
+
+// pipelineAvailable returns whether all the plugins of the pipeline are enabled and installed
+func pipelineAvailable(pipelineID string) (bool, error) {
+	pipeline, err := store.GetPipelineByID(pipelineID)
+	if err != nil {
+		return false, err
+	}
+	for _, step := range pipeline.Steps {
+		plugin, err := store.GetPluginByID(step.PluginID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		if !plugin.Enabled || !plugin.Installed {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/epos-eu/converter-service/dao/model"
+)
+
+func TestStepErrorReply(t *testing.T) {
+	stepError := func(err error) *StepError {
+		return &StepError{PipelineID: "pipeline", Step: 2, Steps: 3, PluginID: "p2", Duration: 1500 * time.Millisecond, Err: err}
+	}
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   ErrorCode
+		wantPlugin string
+		wantStderr string
+	}{
+		{
+			name:       "timeout of the plugin",
+			err:        stepError(newError(CodeTimeout, "p2", fmt.Errorf("plugin p2 did not finish within 1s: %w", ErrPluginTimeout))),
+			wantCode:   CodeTimeout,
+			wantPlugin: "p2",
+		},
+		{
+			name:       "plugin failure",
+			err:        stepError(newError(CodePluginFailed, "p2", &ExecutionError{Err: errors.New("exit status 1"), Stderr: "stack trace"})),
+			wantCode:   CodePluginFailed,
+			wantPlugin: "p2",
+			wantStderr: "stack trace",
+		},
+		{
+			name:       "disabled plugin",
+			err:        stepError(newError(CodePluginDisabled, "p2", errors.New("plugin p2 is disabled"))),
+			wantCode:   CodePluginDisabled,
+			wantPlugin: "p2",
+		},
+		{
+			name:     "unclassified error",
+			err:      stepError(errors.New("unexpected")),
+			wantCode: CodeInternal,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reply := NewErrorReply(test.err).Error
+			if reply.Code != test.wantCode || reply.PluginID != test.wantPlugin || reply.Stderr != test.wantStderr {
+				t.Errorf("got %+v, want the code %s, the plugin %q and the stderr %q", reply, test.wantCode, test.wantPlugin, test.wantStderr)
+			}
+			if !strings.HasPrefix(reply.Message, "step 2/3 of pipeline pipeline (plugin p2) failed after 1.5s: ") {
+				t.Errorf("the message %q does not tell which step failed", reply.Message)
+			}
+		})
+	}
+}
+
+func TestRunPipelineStepError(t *testing.T) {
+	pipeline := model.Pipeline{ID: "pipeline", Name: "p", Steps: []model.PipelineStep{
+		{PluginID: "p1", InputFormat: "application/xml", OutputFormat: "application/json"},
+		{PluginID: "p2", InputFormat: "application/json", OutputFormat: "application/geo+json"},
+	}}
+	tests := []struct {
+		name      string
+		plugins   map[string]model.Plugin
+		pipeline  string
+		wantCode  ErrorCode
+		wantStep  int
+		wantError string
+	}{
+		{
+			name:     "missing pipeline",
+			pipeline: "missing",
+			wantCode: CodePluginNotFound,
+		},
+		{
+			name:     "missing plugin",
+			pipeline: "pipeline",
+			wantCode: CodePluginNotFound,
+			wantStep: 1,
+		},
+		{
+			name:     "disabled plugin",
+			pipeline: "pipeline",
+			plugins:  map[string]model.Plugin{"p1": {ID: "p1", Installed: true}},
+			wantCode: CodePluginDisabled,
+			wantStep: 1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useStore(t, &stubStore{plugins: test.plugins, pipelines: map[string]model.Pipeline{"pipeline": pipeline}})
+			_, _, err := runPipeline(context.Background(), test.pipeline, "{}", Parameters{DistributionID: "distribution"})
+
+			if reply := NewErrorReply(err).Error; reply.Code != test.wantCode {
+				t.Errorf("got the code %s, want %s", reply.Code, test.wantCode)
+			}
+			stepErr, ok := errors.AsType[*StepError](err)
+			if test.wantStep == 0 {
+				if ok {
+					t.Errorf("got %v, want an error outside of the steps", err)
+				}
+				return
+			}
+			if !ok || stepErr.Step != test.wantStep || stepErr.Steps != 2 || stepErr.PluginID != "p1" {
+				t.Errorf("got %v, want an error of step %d/2", err, test.wantStep)
+			}
+		})
+	}
+}
+
+func TestPipelineAvailable(t *testing.T) {
+	pipeline := model.Pipeline{ID: "pipeline", Steps: []model.PipelineStep{{PluginID: "p1"}, {PluginID: "p2"}}}
+	tests := []struct {
+		name    string
+		plugins map[string]model.Plugin
+		want    bool
+	}{
+		{
+			name:    "all enabled and installed",
+			plugins: map[string]model.Plugin{"p1": {Enabled: true, Installed: true}, "p2": {Enabled: true, Installed: true}},
+			want:    true,
+		},
+		{
+			name:    "disabled plugin",
+			plugins: map[string]model.Plugin{"p1": {Enabled: true, Installed: true}, "p2": {Installed: true}},
+		},
+		{
+			name:    "plugin not installed",
+			plugins: map[string]model.Plugin{"p1": {Enabled: true}, "p2": {Enabled: true, Installed: true}},
+		},
+		{
+			name:    "missing plugin",
+			plugins: map[string]model.Plugin{"p1": {Enabled: true, Installed: true}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useStore(t, &stubStore{plugins: test.plugins, pipelines: map[string]model.Pipeline{"pipeline": pipeline}})
+			got, err := pipelineAvailable("pipeline")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != test.want {
+				t.Errorf("got %t, want %t", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRecordExecutionPipelineStep(t *testing.T) {
+	s := &stubStore{}
+	useStore(t, s)
+
+	plugin := model.Plugin{ID: "p2", Runtime: model.SupportedRuntimesBinary}
+	parameters := Parameters{DistributionID: "distribution", PipelineID: "pipeline"}
+	start := time.Now().Add(-1200 * time.Millisecond)
+	recordExecution(withPipelineStep(context.Background(), 2), plugin, parameters, 10, []byte("{}"), nil, start, "")
+
+	if len(s.executions) != 1 {
+		t.Fatalf("got %d executions, want 1", len(s.executions))
+	}
+	execution := s.executions[0]
+	if execution.PipelineID != "pipeline" || execution.PipelineStep != 2 {
+		t.Errorf("got the step %d of pipeline %q, want the step 2 of pipeline", execution.PipelineStep, execution.PipelineID)
+	}
+	if execution.DurationMs < 1200 {
+		t.Errorf("got a duration of %d ms, want at least 1200", execution.DurationMs)
+	}
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// killWaitDelay is how long Wait waits for the I/O of the plugin to be closed after the process has been killed
+const killWaitDelay = 5 * time.Second
+
+// ErrShuttingDown is why the plugins still running at the end of the shutdown are killed
+var ErrShuttingDown = errors.New("the converter-service is shutting down")
+
+var (
+	// every plugin execution derives from this context, cancelled by KillExecutions
+	executionsCtx, cancelExecutions = context.WithCancelCause(context.Background())
+	// the plugin executions in progress, test runs included
+	executions sync.WaitGroup
+	// the number of plugin executions in progress, and of test runs
+	executionsRunning atomic.Int64
+	testRunsRunning   atomic.Int64
+)
+
+// trackExecution returns a context derived from ctx that is also cancelled when the executions are killed on
+// shutdown, test tells whether the execution is a test run. release must be called once the plugin is done.
+func trackExecution(ctx context.Context, test bool) (tracked context.Context, release func()) {
+	running := &executionsRunning
+	if test {
+		running = &testRunsRunning
+	}
+	executions.Add(1)
+	running.Add(1)
+	tracked, cancel := context.WithCancelCause(ctx)
+	stop := context.AfterFunc(executionsCtx, func() {
+		cancel(context.Cause(executionsCtx))
+	})
+	return tracked, func() {
+		stop()
+		cancel(nil)
+		running.Add(-1)
+		executions.Done()
+	}
+}
+
+// KillExecutions kills the process groups of the plugins still running, whatever started them, and waits until ctx is
+// done for their executions to return and remove their temp files. It is called on shutdown once the messages, the
+// requests (test runs included) and the jobs had their time to finish, the plugins started afterwards are killed right
+// away.
+func KillExecutions(ctx context.Context) {
+	if running, testRuns := executionsRunning.Load(), testRunsRunning.Load(); running > 0 || testRuns > 0 {
+		log.Warn("killing the plugins still running", "executions", running, "test_runs", testRuns)
+	}
+	cancelExecutions(ErrShuttingDown)
+
+	done := make(chan struct{})
+	go func() {
+		executions.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Error("plugin executions still running after being killed", "executions", executionsRunning.Load(), "test_runs", testRunsRunning.Load())
+	}
+}
+
+// setProcessGroup makes the plugin the leader of a new process group, so that when its context is done the whole
+// process tree (JVM children, python subprocesses, ...) is killed and not only the direct child
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd.Process)
+	}
+	cmd.WaitDelay = killWaitDelay
+}
+
+// killProcessGroup sends SIGKILL to every process in the group led by p
+func killProcessGroup(p *os.Process) error {
+	if p == nil {
+		return os.ErrProcessDone
+	}
+	err := syscall.Kill(-p.Pid, syscall.SIGKILL)
+	if errors.Is(err, syscall.ESRCH) {
+		return os.ErrProcessDone
+	}
+	return err
+}
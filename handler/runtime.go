@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/internal/env"
+)
+
+// Runtime builds the commands running the plugins of a runtime
+type Runtime interface {
+	// Command returns the command running the plugin on the input file and writing the output file. input and output
+	// are empty for the plugins using the worker protocol, which receive their files with each job.
+	Command(ctx context.Context, plugin model.Plugin, input, output string) (*exec.Cmd, error)
+}
+
+var (
+	// the registered runtimes, by name
+	runtimes = map[model.SupportedRuntimes]Runtime{}
+	// the path of the file defining additional runtimes
+	runtimesConfig string
+
+	errUnknownRuntime = errors.New("unknown runtime")
+	runtimeNameRegexp = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+)
+
+func init() {
+	runtimesConfig = env.Get("RUNTIMES_CONFIG", "")
+
+	RegisterRuntime(model.SupportedRuntimesJava, mustTemplateRuntime(RuntimeConfig{
+		Command: "java" +
+			// Options needed for the EPOS-GEO-JSON library
+			" --add-opens=java.base/java.util=ALL-UNNAMED" +
+			" --add-opens=java.base/sun.reflect.annotation=ALL-UNNAMED" +
+			" -cp {executable} {args} {input} {output}",
+	}), model.ResourceLimits{})
+	RegisterRuntime(model.SupportedRuntimesPython, mustTemplateRuntime(RuntimeConfig{
+		Command: "venv/bin/python {executable} {input} {output}",
+		Workdir: WorkdirPlugin,
+	}), model.ResourceLimits{})
+	binary := mustTemplateRuntime(RuntimeConfig{Command: "{executable} {input} {output}"})
+	RegisterRuntime(model.SupportedRuntimesGo, binary, model.ResourceLimits{})
+	RegisterRuntime(model.SupportedRuntimesBinary, binary, model.ResourceLimits{})
+}
+
+// RegisterRuntime adds the runtime to the registry, replacing the one with the same name if any. limits are the
+// defaults of the plugins of the runtime, overridden by the PLUGIN_<NAME>_* variables. It must be called before the
+// service starts handling messages.
+func RegisterRuntime(name model.SupportedRuntimes, runtime Runtime, limits model.ResourceLimits) {
+	runtimes[name] = runtime
+	prefix := "PLUGIN_" + strings.ToUpper(strings.ReplaceAll(name.String(), "-", "_")) + "_"
+	runtimeLimits[name] = limitsFromEnv(prefix, limits)
+	model.RegisterRuntime(name)
+}
+
+// LoadRuntimes registers the runtimes defined in the file at RUNTIMES_CONFIG, if set. The file is a JSON object
+// mapping the name of each runtime to its RuntimeConfig, a runtime with the name of a builtin one replaces it.
+func LoadRuntimes() error {
+	if runtimesConfig == "" {
+		return nil
+	}
+	content, err := os.ReadFile(runtimesConfig)
+	if err != nil {
+		return fmt.Errorf("error reading the runtimes configuration: %w", err)
+	}
+	var configs map[string]RuntimeConfig
+	if err := json.Unmarshal(content, &configs); err != nil {
+		return fmt.Errorf("error parsing the runtimes configuration %s: %w", runtimesConfig, err)
+	}
+
+	for name, config := range configs {
+		if !runtimeNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid runtime name %q: it must match %s", name, runtimeNameRegexp)
+		}
+		runtime, err := newTemplateRuntime(config)
+		if err != nil {
+			return fmt.Errorf("invalid runtime %s: %w", name, err)
+		}
+		if err := config.Limits.Validate(); err != nil {
+			return fmt.Errorf("invalid limits of runtime %s: %w", name, err)
+		}
+		_, replaced := runtimes[model.SupportedRuntimes(name)]
+		RegisterRuntime(model.SupportedRuntimes(name), runtime, config.Limits)
+		log.Info("runtime registered", "runtime", name, "command", config.Command, "replaces_builtin", replaced)
+	}
+	return nil
+}
+
+// pluginRuntime returns the runtime of the plugin
+func pluginRuntime(plugin model.Plugin) (Runtime, error) {
+	runtime, ok := runtimes[plugin.Runtime]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s is not in any of %+v", errUnknownRuntime, plugin.Runtime, model.SupportedRuntimesValues())
+	}
+	return runtime, nil
+}
+
+// the directories a runtime can run its plugins in
+const (
+	// the directory of the service, the default
+	WorkdirService = "service"
+	// the directory of the plugin, ./plugins/<id>
+	WorkdirPlugin = "plugin"
+)
+
+// RuntimeConfig defines a runtime with a command template. The template is split on spaces and each of the following
+// placeholders is replaced:
+//   - {executable}: the path of the executable of the plugin, relative to the working directory
+//   - {plugin_dir}: the path of the directory of the plugin, relative to the working directory
+//   - {plugin_id}: the id of the plugin
+//   - {args}: the arguments of the plugin, as they are. When it is a whole argument of the template, they are passed as a
+//     single argument (as the java command always did, e.g. the main class), which is dropped when they are empty
+//   - {input} and {output}: the input and output files. Arguments made of one of them are dropped for the plugins using
+//     the worker protocol
+type RuntimeConfig struct {
+	// the command template, e.g. "node {executable} {args} {input} {output}"
+	Command string `json:"command"`
+	// the directory the plugins run in: "service" (the default) or "plugin"
+	Workdir string `json:"workdir,omitempty"`
+	// the default limits of the plugins of the runtime
+	Limits model.ResourceLimits `json:"limits"`
+}
+
+// templateRuntime is a Runtime building its commands from a template
+type templateRuntime struct {
+	args    []string
+	workdir string
+}
+
+var placeholderRegexp = regexp.MustCompile(`\{[a-z_]*\}`)
+
+func newTemplateRuntime(config RuntimeConfig) (*templateRuntime, error) {
+	args := strings.Fields(config.Command)
+	if len(args) == 0 {
+		return nil, errors.New("the command is empty")
+	}
+	for _, arg := range args {
+		for _, placeholder := range placeholderRegexp.FindAllString(arg, -1) {
+			switch placeholder {
+			case "{executable}", "{plugin_dir}", "{plugin_id}", "{args}", "{input}", "{output}":
+			default:
+				return nil, fmt.Errorf("unknown placeholder %s in the command %q", placeholder, config.Command)
+			}
+		}
+	}
+	switch config.Workdir {
+	case "", WorkdirService, WorkdirPlugin:
+	default:
+		return nil, fmt.Errorf("invalid workdir %q: must be %q or %q", config.Workdir, WorkdirService, WorkdirPlugin)
+	}
+	return &templateRuntime{args: args, workdir: config.Workdir}, nil
+}
+
+func mustTemplateRuntime(config RuntimeConfig) *templateRuntime {
+	runtime, err := newTemplateRuntime(config)
+	if err != nil {
+		panic(err)
+	}
+	return runtime
+}
+
+func (r *templateRuntime) Command(ctx context.Context, plugin model.Plugin, input, output string) (*exec.Cmd, error) {
+	pluginDir := "./" + filepath.Join("plugins", plugin.ID)
+	executable := "./" + filepath.Join(pluginDir, plugin.Executable)
+	dir := ""
+	if r.workdir == WorkdirPlugin {
+		dir = pluginDir
+		pluginDir = "."
+		executable = plugin.Executable
+	}
+
+	replacer := strings.NewReplacer(
+		"{executable}", executable,
+		"{plugin_dir}", pluginDir,
+		"{plugin_id}", plugin.ID,
+		"{args}", plugin.Arguments,
+		"{input}", input,
+		"{output}", output,
+	)
+	args := make([]string, 0, len(r.args))
+	for _, arg := range r.args {
+		switch {
+		case arg == "{args}":
+			if plugin.Arguments != "" {
+				args = append(args, plugin.Arguments)
+			}
+		case (arg == "{input}" || arg == "{output}") && input == "":
+			// the files are sent to workers with each job
+		default:
+			args = append(args, replacer.Replace(arg))
+		}
+	}
+
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Dir = dir
+	return cmd, nil
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/epos-eu/converter-service/dao/model"
+)
+
+func TestTemplateRuntimeCommand(t *testing.T) {
+	plugin := model.Plugin{ID: "p1", Executable: "converter.jar", Arguments: "org.epos.Main --flag"}
+	tests := []struct {
+		name    string
+		config  RuntimeConfig
+		plugin  model.Plugin
+		input   string
+		output  string
+		want    []string
+		wantDir string
+	}{
+		{
+			name:   "all the placeholders",
+			config: RuntimeConfig{Command: "run {executable} {plugin_dir} {plugin_id} {args} {input} {output}"},
+			plugin: plugin,
+			input:  "in",
+			output: "out",
+			want:   []string{"run", "./plugins/p1/converter.jar", "./plugins/p1", "p1", "org.epos.Main --flag", "in", "out"},
+		},
+		{
+			name:   "placeholder inside of an argument",
+			config: RuntimeConfig{Command: "run --plugin={plugin_id} --out={output} {input}"},
+			plugin: plugin,
+			input:  "in",
+			output: "out",
+			want:   []string{"run", "--plugin=p1", "--out=out", "in"},
+		},
+		{
+			name:   "empty arguments are dropped",
+			config: RuntimeConfig{Command: "run {executable} {args} {input} {output}"},
+			plugin: model.Plugin{ID: "p1", Executable: "converter"},
+			input:  "in",
+			output: "out",
+			want:   []string{"run", "./plugins/p1/converter", "in", "out"},
+		},
+		{
+			name:   "arguments inside of an argument",
+			config: RuntimeConfig{Command: "run --args={args}"},
+			plugin: plugin,
+			want:   []string{"run", "--args=org.epos.Main --flag"},
+		},
+		{
+			name:   "worker without files",
+			config: RuntimeConfig{Command: "run {executable} {input} {output}"},
+			plugin: plugin,
+			want:   []string{"run", "./plugins/p1/converter.jar"},
+		},
+		{
+			name:    "plugin workdir",
+			config:  RuntimeConfig{Command: "venv/bin/python {executable} {plugin_dir} {input} {output}", Workdir: WorkdirPlugin},
+			plugin:  model.Plugin{ID: "p1", Executable: "main.py"},
+			input:   "/tmp/in",
+			output:  "/tmp/out",
+			want:    []string{"venv/bin/python", "main.py", ".", "/tmp/in", "/tmp/out"},
+			wantDir: "./plugins/p1",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			runtime, err := newTemplateRuntime(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cmd, err := runtime.Command(context.Background(), test.plugin, test.input, test.output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(cmd.Args, test.want) {
+				t.Errorf("got the arguments %q, want %q", cmd.Args, test.want)
+			}
+			if cmd.Dir != test.wantDir {
+				t.Errorf("got the directory %q, want %q", cmd.Dir, test.wantDir)
+			}
+		})
+	}
+}
+
+func TestNewTemplateRuntimeInvalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		config RuntimeConfig
+		want   string
+	}{
+		{name: "empty command", config: RuntimeConfig{Command: " "}, want: "empty"},
+		{name: "unknown placeholder", config: RuntimeConfig{Command: "run {plugin} {input}"}, want: "unknown placeholder {plugin}"},
+		{name: "unknown placeholder inside of an argument", config: RuntimeConfig{Command: "run --x={inputs}"}, want: "unknown placeholder {inputs}"},
+		{name: "invalid workdir", config: RuntimeConfig{Command: "run", Workdir: "tmp"}, want: "invalid workdir"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := newTemplateRuntime(test.config)
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
+
+// useRuntimesConfig makes LoadRuntimes read content, and restores the registered runtimes at the end of the test
+func useRuntimesConfig(t *testing.T, content string) {
+	t.Helper()
+	previousRuntimes, previousLimits, previousConfig := maps.Clone(runtimes), maps.Clone(runtimeLimits), runtimesConfig
+	t.Cleanup(func() {
+		runtimes, runtimeLimits, runtimesConfig = previousRuntimes, previousLimits, previousConfig
+	})
+
+	runtimesConfig = filepath.Join(t.TempDir(), "runtimes.json")
+	if content != "" {
+		if err := os.WriteFile(runtimesConfig, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadRuntimes(t *testing.T) {
+	useRuntimesConfig(t, `{
+		"java": {"command": "java -Xmx1g -jar {executable} {input} {output}", "limits": {"memory_mb": 2048}},
+		"node": {"command": "node {executable} {args} {input} {output}", "workdir": "plugin"}
+	}`)
+	if err := LoadRuntimes(); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err := runtimes[model.SupportedRuntimesJava].Command(context.Background(), model.Plugin{ID: "p1", Executable: "c.jar"}, "in", "out")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"java", "-Xmx1g", "-jar", "./plugins/p1/c.jar", "in", "out"}; !slices.Equal(cmd.Args, want) {
+		t.Errorf("the builtin java runtime was not replaced: got %q, want %q", cmd.Args, want)
+	}
+	if got := runtimeLimits[model.SupportedRuntimesJava].MemoryMB; got != 2048 {
+		t.Errorf("got a memory limit of %d MiB for java, want 2048", got)
+	}
+	if _, ok := runtimes["node"]; !ok {
+		t.Error("the node runtime was not registered")
+	}
+}
+
+func TestLoadRuntimesInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "missing file", want: "error reading the runtimes configuration"},
+		{name: "invalid JSON", content: `{"node": {"command": "node {executable}"`, want: "error parsing the runtimes configuration"},
+		{name: "invalid name", content: `{"Node JS": {"command": "node {executable}"}}`, want: "invalid runtime name"},
+		{name: "unknown placeholder", content: `{"node": {"command": "node {plugin}"}}`, want: "unknown placeholder {plugin}"},
+		{name: "invalid limits", content: `{"node": {"command": "node {executable}", "limits": {"memory_mb": -1}}}`, want: "invalid limits"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useRuntimesConfig(t, test.content)
+			err := LoadRuntimes()
+			if err == nil || !strings.Contains(err.Error(), test.want) {
+				t.Errorf("got %v, want an error containing %q", err, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package handler
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/internal/env"
+	"github.com/epos-eu/converter-service/launcher"
+)
+
+// sandboxPath is the PATH of the sandboxed plugins, as their environment is cleared
+const sandboxPath = "/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+var sandboxEnabled = false
+
+func init() {
+	sandboxEnabled = env.Get("PLUGIN_SANDBOX", "false") == "true"
+}
+
+// applySandbox configures cmd to run the plugin in a sandbox, adding to spec the filesystem the launcher has to set up.
+// Unless its policy relaxes them, the plugin gets a cleared environment, no network and a private /tmp. It always gets
+// its own PID namespace and /proc, so that it can't see the service nor read its environment, and the service
+// directory is hidden but for its own plugin directory, read-only, and its workDir: the other plugins and the files of
+// the other executions are out of its reach. The whole filesystem is read-only, but for workDir and /tmp.
+func applySandbox(cmd *exec.Cmd, spec *launcher.Spec, plugin model.Plugin, serviceDir, workDir string) error {
+	policy := plugin.Sandbox
+	pluginDir := filepath.Join(serviceDir, "plugins", plugin.ID)
+
+	vars := []string{
+		"PATH=" + sandboxPath,
+		"HOME=" + workDir,
+		"TMPDIR=" + workDir,
+		"LANG=C.UTF-8",
+	}
+	for _, name := range policy.AllowEnv {
+		if value, ok := os.LookupEnv(name); ok {
+			vars = append(vars, name+"="+value)
+		}
+	}
+	cmd.Env = vars
+
+	sandbox := &launcher.Sandbox{
+		Hidden:       []string{serviceDir},
+		ReadOnlyRoot: true,
+		PrivateTmp:   !policy.SharedTmp,
+		PrivateProc:  true,
+	}
+	// before workDir, which may be inside of it
+	if policy.SharedTmp {
+		sandbox.Writable = append(sandbox.Writable, os.TempDir())
+	}
+	sandbox.Writable = append(sandbox.Writable, workDir)
+	if policy.WritablePluginDir {
+		sandbox.Writable = append(sandbox.Writable, pluginDir)
+	} else {
+		sandbox.ReadOnly = append(sandbox.ReadOnly, pluginDir)
+	}
+	spec.Sandbox = sandbox
+
+	return setNamespaces(cmd, !policy.AllowNetwork)
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package handler
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setNamespaces makes cmd start in new user, mount and PID namespaces, and in a new network namespace if
+// privateNetwork. The launcher runs as root of the user namespace to be able to set up the mounts, it drops every
+// capability before executing the plugin. The plugin is the init of its PID namespace: everything it started is
+// killed with it.
+func setNamespaces(cmd *exec.Cmd, privateNetwork bool) error {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | syscall.CLONE_NEWPID
+	if privateNetwork {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getuid(), Size: 1}}
+	cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{{ContainerID: 0, HostID: os.Getgid(), Size: 1}}
+	cmd.SysProcAttr.GidMappingsEnableSetgroups = false
+	return nil
+}
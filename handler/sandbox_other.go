@@ -0,0 +1,12 @@
+//go:build !linux
+
+package handler
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func setNamespaces(*exec.Cmd, bool) error {
+	return fmt.Errorf("the plugin sandbox is only available on linux")
+}
@@ -0,0 +1,103 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/epos-eu/converter-service/dao/model"
+)
+
+var (
+	// ErrNoMatchingPlugin is returned when no plugin or pipeline of a distribution converts between the requested content
+	// types
+	ErrNoMatchingPlugin = errors.New("no plugin matches the requested content types")
+	// ErrAmbiguousPlugin is returned when more than one plugin or pipeline of a distribution converts between the
+	// requested content types equally well
+	ErrAmbiguousPlugin = errors.New("more than one plugin matches the requested content types")
+)
+
+// how well a requested content type matches the format of a relation
+const (
+	noMatch = iota
+	// one of the two is a full wildcard, or no content type was requested
+	anyMatch
+	// one of the two is a wildcard of the subtype
+	typeMatch
+	exactMatch
+)
+
+// selectRelation returns the relation of the distribution, to a plugin or a pipeline, converting requestFormat into
+// responseFormat. Only the enabled and installed plugins are considered, and the most specific match is preferred.
+func selectRelation(distributionID, requestFormat, responseFormat string) (model.PluginRelation, error) {
+	relations, err := store.GetEnabledPluginRelationsByRelationID(distributionID)
+	if err != nil {
+		return model.PluginRelation{}, fmt.Errorf("error getting the plugins of distribution %s: %w", distributionID, err)
+	}
+
+	var best []model.PluginRelation
+	bestScore := 0
+	for _, relation := range relations {
+		input := matchContentType(requestFormat, relation.InputFormat)
+		output := matchContentType(responseFormat, relation.OutputFormat)
+		if input == noMatch || output == noMatch {
+			continue
+		}
+		switch score := input + output; {
+		case score > bestScore:
+			best, bestScore = []model.PluginRelation{relation}, score
+		case score == bestScore:
+			best = append(best, relation)
+		}
+	}
+
+	// several relations of the distribution can point at the same plugin or pipeline
+	targets := map[model.PluginRelation]struct{}{}
+	for _, relation := range best {
+		targets[model.PluginRelation{PluginID: relation.PluginID, PipelineID: relation.PipelineID}] = struct{}{}
+	}
+	switch len(targets) {
+	case 0:
+		return model.PluginRelation{}, fmt.Errorf("%w: distribution %s, from %q to %q, candidates: %s", ErrNoMatchingPlugin, distributionID, requestFormat, responseFormat, describeRelations(relations))
+	case 1:
+		return best[0], nil
+	default:
+		return model.PluginRelation{}, fmt.Errorf("%w: distribution %s, from %q to %q, candidates: %s", ErrAmbiguousPlugin, distributionID, requestFormat, responseFormat, describeRelations(best))
+	}
+}
+
+// matchContentType returns how well the requested content type matches the format of a relation. Wildcards are allowed
+// on both sides and the parameters (e.g. charset) are ignored.
+func matchContentType(requested, format string) int {
+	if requested == "" {
+		return anyMatch
+	}
+	requested, format = model.MediaType(requested), model.MediaType(format)
+	if requested == format {
+		return exactMatch
+	}
+	if requested == "*/*" || format == "*/*" {
+		return anyMatch
+	}
+	requestedType, requestedSubtype, _ := strings.Cut(requested, "/")
+	formatType, formatSubtype, _ := strings.Cut(format, "/")
+	if requestedType == formatType && (requestedSubtype == "*" || formatSubtype == "*") {
+		return typeMatch
+	}
+	return noMatch
+}
+
+func describeRelations(relations []model.PluginRelation) string {
+	if len(relations) == 0 {
+		return "none"
+	}
+	candidates := make([]string, 0, len(relations))
+	for _, relation := range relations {
+		target := "plugin " + relation.PluginID.String()
+		if relation.PipelineID != "" {
+			target = "pipeline " + relation.PipelineID.String()
+		}
+		candidates = append(candidates, fmt.Sprintf("%s (%s -> %s)", target, relation.InputFormat, relation.OutputFormat))
+	}
+	return strings.Join(candidates, ", ")
+}
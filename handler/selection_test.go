@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/epos-eu/converter-service/dao/model"
+)
+
+func TestMatchContentType(t *testing.T) {
+	tests := []struct {
+		requested string
+		format    string
+		want      int
+	}{
+		{requested: "", format: "application/json", want: anyMatch},
+		{requested: "", format: "*/*", want: anyMatch},
+		{requested: "application/json", format: "application/json", want: exactMatch},
+		{requested: "*/*", format: "*/*", want: exactMatch},
+		{requested: "*/*", format: "application/json", want: anyMatch},
+		{requested: "application/json", format: "*/*", want: anyMatch},
+		{requested: "application/*", format: "application/json", want: typeMatch},
+		{requested: "application/geo+json", format: "application/*", want: typeMatch},
+		{requested: "text/*", format: "application/json", want: noMatch},
+		{requested: "application/json", format: "application/xml", want: noMatch},
+		{requested: "text/csv", format: "application/csv", want: noMatch},
+		// the parameters are ignored, and the types are case insensitive
+		{requested: "application/json; charset=utf-8", format: "application/json", want: exactMatch},
+		{requested: "text/csv", format: "text/csv;header=present", want: exactMatch},
+		{requested: "Application/JSON", format: "application/json", want: exactMatch},
+		{requested: "APPLICATION/*; q=0.5", format: "application/json", want: typeMatch},
+	}
+	for _, test := range tests {
+		t.Run(test.requested+" "+test.format, func(t *testing.T) {
+			if got := matchContentType(test.requested, test.format); got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSelectRelation(t *testing.T) {
+	const distribution = "distribution"
+	relation := func(id, plugin, pipeline, input, output string) model.PluginRelation {
+		return model.PluginRelation{
+			ID:           id,
+			PluginID:     model.NullableID(plugin),
+			PipelineID:   model.NullableID(pipeline),
+			RelationID:   distribution,
+			InputFormat:  input,
+			OutputFormat: output,
+		}
+	}
+
+	tests := []struct {
+		name      string
+		relations []model.PluginRelation
+		request   string
+		response  string
+		want      string
+		wantErr   error
+	}{
+		{
+			name:     "no relation",
+			request:  "application/json",
+			response: "application/geo+json",
+			wantErr:  ErrNoMatchingPlugin,
+		},
+		{
+			name: "no matching relation",
+			relations: []model.PluginRelation{
+				relation("r1", "p1", "", "application/xml", "application/geo+json"),
+			},
+			request:  "application/json",
+			response: "application/geo+json",
+			wantErr:  ErrNoMatchingPlugin,
+		},
+		{
+			name: "single relation without requested types",
+			relations: []model.PluginRelation{
+				relation("r1", "p1", "", "application/json", "application/geo+json"),
+			},
+			want: "r1",
+		},
+		{
+			name: "exact match preferred to a wildcard",
+			relations: []model.PluginRelation{
+				relation("r1", "p1", "", "application/*", "application/geo+json"),
+				relation("r2", "p2", "", "application/json", "application/geo+json"),
+				relation("r3", "p3", "", "*/*", "*/*"),
+			},
+			request:  "application/json",
+			response: "application/geo+json",
+			want:     "r2",
+		},
+		{
+			name: "subtype wildcard preferred to a full wildcard",
+			relations: []model.PluginRelation{
+				relation("r1", "p1", "", "*/*", "application/geo+json"),
+				relation("r2", "p2", "", "application/*", "application/geo+json"),
+			},
+			request:  "application/json",
+			response: "application/geo+json",
+			want:     "r2",
+		},
+		{
+			name: "parameters and case of the requested types",
+			relations: []model.PluginRelation{
+				relation("r1", "p1", "", "text/csv", "application/geo+json"),
+				relation("r2", "p2", "", "application/json", "application/geo+json"),
+			},
+			request:  "Application/JSON; charset=utf-8",
+			response: "application/geo+json",
+			want:     "r2",
+		},
+		{
+			name: "pipeline",
+			relations: []model.PluginRelation{
+				relation("r1", "p1", "", "application/xml", "application/json"),
+				relation("r2", "", "pipeline", "application/xml", "application/geo+json"),
+			},
+			request:  "application/xml",
+			response: "application/geo+json",
+			want:     "r2",
+		},
+		{
+			name: "equal candidates with the same target",
+			relations: []model.PluginRelation{
+				relation("r1", "p1", "", "application/json", "*/*"),
+				relation("r2", "p1", "", "*/*", "application/geo+json"),
+			},
+			request:  "application/json",
+			response: "application/geo+json",
+			want:     "r1",
+		},
+		{
+			name: "equal candidates with different plugins",
+			relations: []model.PluginRelation{
+				relation("r1", "p1", "", "application/json", "application/geo+json"),
+				relation("r2", "p2", "", "application/json", "application/geo+json"),
+			},
+			request:  "application/json",
+			response: "application/geo+json",
+			wantErr:  ErrAmbiguousPlugin,
+		},
+		{
+			name: "equal candidates with a plugin and a pipeline",
+			relations: []model.PluginRelation{
+				relation("r1", "p1", "", "application/json", "application/*"),
+				relation("r2", "", "pipeline", "application/*", "application/geo+json"),
+			},
+			request:  "application/json",
+			response: "application/geo+json",
+			wantErr:  ErrAmbiguousPlugin,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			useStore(t, &stubStore{relations: test.relations})
+			got, err := selectRelation(distribution, test.request, test.response)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Errorf("got %v, want %v", err, test.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.ID != test.want {
+				t.Errorf("got the relation %s, want %s", got.ID, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/db"
+)
+
+// Store is what the handlers read from the plugin catalogue and change in it, and the execution history they write to
+type Store interface {
+	GetPluginByID(pluginID string) (model.Plugin, error)
+	GetPipelineByID(pipelineID string) (model.Pipeline, error)
+	// the relations of the distribution pointing at a plugin that is enabled and installed, or at a pipeline whose
+	// plugins all are
+	GetEnabledPluginRelationsByRelationID(distributionID string) ([]model.PluginRelation, error)
+	// the relations pointing at a plugin that is enabled and installed
+	GetPluginRelationForEnabledPlugins() ([]model.PluginRelation, error)
+	// the relations pointing at a pipeline
+	GetPipelineRelations() ([]model.PluginRelation, error)
+	GetFixturesByPluginID(pluginID string) ([]model.PluginFixture, error)
+	// enables or disables the plugin, e.g. when its fixtures fail
+	EnablePlugin(pluginID string, enable bool) error
+	CreateExecution(execution model.Execution) error
+}
+
+// store is the database unless UseStore replaced it
+var store Store = dbStore{}
+
+// UseStore makes the handlers use s in place of the database, e.g. to run the message flow in tests, and returns the
+// store used so far. It must be called before any message is handled.
+func UseStore(s Store) Store {
+	previous := store
+	store = s
+	return previous
+}
+
+// dbStore is the Store of the converter_catalogue schema
+type dbStore struct{}
+
+func (dbStore) GetPluginByID(pluginID string) (model.Plugin, error) {
+	return db.GetPluginByID(pluginID)
+}
+
+func (dbStore) GetPipelineByID(pipelineID string) (model.Pipeline, error) {
+	return db.GetPipelineByID(pipelineID)
+}
+
+func (dbStore) GetEnabledPluginRelationsByRelationID(distributionID string) ([]model.PluginRelation, error) {
+	return db.GetEnabledPluginRelationsByRelationID(distributionID)
+}
+
+func (dbStore) GetPluginRelationForEnabledPlugins() ([]model.PluginRelation, error) {
+	return db.GetPluginRelationForEnabledPlugins()
+}
+
+func (dbStore) GetPipelineRelations() ([]model.PluginRelation, error) {
+	return db.GetPipelineRelations()
+}
+
+func (dbStore) GetFixturesByPluginID(pluginID string) ([]model.PluginFixture, error) {
+	return db.GetFixturesByPluginID(pluginID)
+}
+
+func (dbStore) EnablePlugin(pluginID string, enable bool) error {
+	return db.EnablePlugin(pluginID, enable)
+}
+
+func (dbStore) CreateExecution(execution model.Execution) error {
+	return db.CreateExecution(execution)
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"gorm.io/gorm"
+)
+
+// stubStore is a Store kept in memory. The relations it returns are already filtered, as the database would.
+type stubStore struct {
+	mu         sync.Mutex
+	plugins    map[string]model.Plugin
+	pipelines  map[string]model.Pipeline
+	relations  []model.PluginRelation
+	fixtures   map[string][]model.PluginFixture
+	executions []model.Execution
+}
+
+// useStore makes the handlers use s until the end of the test
+func useStore(t *testing.T, s *stubStore) {
+	t.Helper()
+	previous := UseStore(s)
+	t.Cleanup(func() { UseStore(previous) })
+}
+
+func (s *stubStore) GetPluginByID(pluginID string) (model.Plugin, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	plugin, ok := s.plugins[pluginID]
+	if !ok {
+		return plugin, gorm.ErrRecordNotFound
+	}
+	return plugin, nil
+}
+
+func (s *stubStore) GetPipelineByID(pipelineID string) (model.Pipeline, error) {
+	pipeline, ok := s.pipelines[pipelineID]
+	if !ok {
+		return pipeline, gorm.ErrRecordNotFound
+	}
+	return pipeline, nil
+}
+
+func (s *stubStore) GetEnabledPluginRelationsByRelationID(distributionID string) ([]model.PluginRelation, error) {
+	var relations []model.PluginRelation
+	for _, relation := range s.relations {
+		if relation.RelationID == distributionID {
+			relations = append(relations, relation)
+		}
+	}
+	return relations, nil
+}
+
+func (s *stubStore) GetPluginRelationForEnabledPlugins() ([]model.PluginRelation, error) {
+	var relations []model.PluginRelation
+	for _, relation := range s.relations {
+		if relation.PluginID != "" {
+			relations = append(relations, relation)
+		}
+	}
+	return relations, nil
+}
+
+func (s *stubStore) GetPipelineRelations() ([]model.PluginRelation, error) {
+	var relations []model.PluginRelation
+	for _, relation := range s.relations {
+		if relation.PipelineID != "" {
+			relations = append(relations, relation)
+		}
+	}
+	return relations, nil
+}
+
+func (s *stubStore) GetFixturesByPluginID(pluginID string) ([]model.PluginFixture, error) {
+	return s.fixtures[pluginID], nil
+}
+
+func (s *stubStore) EnablePlugin(pluginID string, enable bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	plugin, ok := s.plugins[pluginID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	plugin.Enabled = enable
+	s.plugins[pluginID] = plugin
+	return nil
+}
+
+func (s *stubStore) CreateExecution(execution model.Execution) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.executions = append(s.executions, execution)
+	return nil
+}
@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// TestReport is the result of a test run of a plugin
+type TestReport struct {
+	PluginID string `json:"plugin_id"`
+	// whether the plugin converted the payload into a valid output
+	Success bool `json:"success"`
+	// the output written by the plugin, as is
+	Output string `json:"output,omitempty"`
+	// the exit code of the plugin process, not set for the plugins using the worker protocol
+	ExitCode *int `json:"exit_code,omitempty"`
+	// the end of the stdout and stderr of the plugin, at most PLUGIN_OUTPUT_LIMIT bytes each. For a worker, stdout
+	// carries the protocol and is not captured, stderr is what the worker wrote during the test job.
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+	// the time the conversion took, and the CPU time of the plugin process (not set for workers)
+	WallTimeMs int64 `json:"wall_time_ms"`
+	CPUTimeMs  int64 `json:"cpu_time_ms"`
+	// the checks the output must pass to be sent back to the callers
+	Validation []OutputCheck `json:"validation"`
+	// why the conversion failed
+	Error *ErrorEnvelope `json:"error,omitempty"`
+}
+
+// OutputCheck is a check of the output of a plugin
+type OutputCheck struct {
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Error  string `json:"error,omitempty"`
+}
+
+type processReportKey struct{}
+
+// processReport is what is captured of the process running a plugin, for the execution history and the test runs
+type processReport struct {
+	// whether the execution is a test run, the test runs keep the last outputLimit bytes of each output stream of the
+	// plugin rather than only the end of stderr
+	test       bool
+	exitCode   *int
+	stdout     string
+	stderr     string
+	stderrTail string
+	cpuTime    time.Duration
+}
+
+// recordProcess records the exited process of a plugin in the report of ctx, if there is one
+func recordProcess(ctx context.Context, state *os.ProcessState, stdout, stderr *tailBuffer) {
+	report, ok := ctx.Value(processReportKey{}).(*processReport)
+	if !ok {
+		return
+	}
+	report.stderrTail = stderr.tail(stderrTailLength)
+	if report.test {
+		report.stdout = stdout.String()
+		report.stderr = stderr.String()
+	}
+	if state != nil {
+		exitCode := state.ExitCode()
+		report.exitCode = &exitCode
+		report.cpuTime = state.UserTime() + state.SystemTime()
+	}
+}
+
+// recordWorker records the worker that ran a job in the report of ctx, if there is one. The stderr of the worker only
+// holds what it wrote during the job.
+func recordWorker(ctx context.Context, w *worker) {
+	report, ok := ctx.Value(processReportKey{}).(*processReport)
+	if !ok {
+		return
+	}
+	report.stderrTail = w.stderr.tail(stderrTailLength)
+	if report.test {
+		report.stderr = w.stderr.String()
+	}
+}
+
+// TestPlugin runs the plugin on the payload through the same execution path as the conversions, and reports how it
+// went. The plugin does not have to be enabled. The error is only set if the plugin could not be run at all.
+func TestPlugin(ctx context.Context, pluginID string, message Message) (TestReport, error) {
+	report := TestReport{PluginID: pluginID, Validation: []OutputCheck{}}
+
+	plugin, err := store.GetPluginByID(pluginID)
+	if err != nil {
+		return report, notFoundOr(pluginID, fmt.Errorf("error getting plugin: %w", err))
+	}
+	if !plugin.Installed {
+		return report, newError(CodePluginDisabled, plugin.ID, fmt.Errorf("plugin %s is not installed", plugin.ID))
+	}
+	message.Parameters.PluginID = plugin.ID
+
+	process := &processReport{test: true}
+	ctx = context.WithValue(ctx, processReportKey{}, process)
+	start := time.Now()
+	output, err := runPluginWithTimeout(ctx, plugin, message.Payload, message.Parameters)
+	report.WallTimeMs = time.Since(start).Milliseconds()
+	report.ExitCode = process.exitCode
+	report.Stdout = process.stdout
+	report.Stderr = process.stderr
+	report.CPUTimeMs = process.cpuTime.Milliseconds()
+	if err != nil {
+		reply := NewErrorReply(err)
+		report.Error = &reply.Error
+		return report, nil
+	}
+
+	report.Output = string(output)
+	report.Validation = validateOutput(output)
+	report.Success = true
+	for _, check := range report.Validation {
+		report.Success = report.Success && check.Passed
+	}
+	return report, nil
+}
+
+// validateOutput checks the output like wrapOutput does before sending it back to the callers
+func validateOutput(output []byte) []OutputCheck {
+	notEmpty := OutputCheck{Name: "not_empty", Passed: len(output) > 0}
+	if !notEmpty.Passed {
+		notEmpty.Error = "the output is empty"
+	}
+
+	validJSON := OutputCheck{Name: "valid_json", Passed: json.Valid(output)}
+	if !validJSON.Passed {
+		validJSON.Error = "the output is not valid JSON"
+	}
+
+	object := OutputCheck{Name: "json_object", Passed: true}
+	if _, err := wrapOutput(output); err != nil {
+		object.Passed = false
+		object.Error = err.Error()
+	}
+	return []OutputCheck{notEmpty, validJSON, object}
+}
@@ -0,0 +1,511 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/internal/env"
+	"github.com/epos-eu/converter-service/tracing"
+	"github.com/google/uuid"
+)
+
+// Plugins declaring the worker protocol are started once and kept running in a pool per plugin. A worker receives one
+// job at a time as a line of JSON on its stdin, and answers with a line of JSON on its stdout once the output file has
+// been written (so it must log on stderr only). Workers are restarted when they crash, after workerMaxJobs jobs and
+// after being idle for workerIdleTimeout. The stderr reported for a job is what the worker wrote since the job was sent.
+// The resource limits of the plugin apply to the whole life of a worker, but for the CPU time limit that applies to each
+// job as for oneshot plugins: the worker is killed when a job goes over it, and retired when what is left of the CPU
+// time of its workerMaxJobs jobs is less than the limit of one job.
+
+// workerProtocolEnv is set in the environment of the plugins started as workers
+const workerProtocolEnv = "CONVERTER_PLUGIN_PROTOCOL=worker"
+
+const (
+	// maximum size of a frame written by a worker
+	maxFrameSize = 1024 * 1024
+	// how often the CPU time of a job is checked against the limit
+	cpuCheckInterval = 200 * time.Millisecond
+)
+
+var (
+	workerPoolSize    = 2
+	workerMaxJobs     = 1000
+	workerIdleTimeout = 5 * time.Minute
+	pools             = &workerPools{pools: map[string]*workerPool{}}
+
+	errWorkerExited = errors.New("the worker exited")
+)
+
+func init() {
+	workerPoolSize = env.Int("WORKER_POOL_SIZE", workerPoolSize)
+	workerMaxJobs = env.Int("WORKER_MAX_JOBS", workerMaxJobs)
+	workerIdleTimeout = time.Duration(env.Int("WORKER_IDLE_TIMEOUT", int(workerIdleTimeout.Seconds()))) * time.Second
+}
+
+// workerJob is the frame sent to a worker for each conversion
+type workerJob struct {
+	ID         string     `json:"id"`
+	Input      string     `json:"input"`
+	Output     string     `json:"output"`
+	Parameters Parameters `json:"parameters"`
+	// the W3C traceparent of the job, as the environment of a worker is set once for all its jobs
+	Traceparent string `json:"traceparent,omitempty"`
+}
+
+// workerResult is the frame a worker answers with once a job is done, Error is empty on success
+type workerResult struct {
+	ID    string `json:"id"`
+	Error string `json:"error,omitempty"`
+}
+
+// runWorkerJob runs the payload through a worker of the plugin
+func runWorkerJob(ctx context.Context, runtime Runtime, plugin model.Plugin, payload string, parameters Parameters) ([]byte, error) {
+	pool := pools.get(runtime, plugin)
+	w, err := pool.acquire(ctx)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return nil, &ExecutionError{Err: fmt.Errorf("%w: no worker available: %w", ErrPluginTimeout, err)}
+		}
+		return nil, err
+	}
+	defer pool.release(w)
+
+	job := workerJob{
+		ID:          uuid.NewString(),
+		Input:       filepath.Join(w.dir, "input-"+randomString(10)),
+		Output:      filepath.Join(w.dir, "output-"+randomString(10)),
+		Parameters:  parameters,
+		Traceparent: tracing.Traceparent(ctx),
+	}
+	_, span := tracer.Start(ctx, "createTempFiles")
+	err = os.WriteFile(job.Input, []byte(payload), 0o644)
+	tracing.End(span, err)
+	if err != nil {
+		return nil, fmt.Errorf("error writing to temp input file: %w", err)
+	}
+	defer cleanupTempFiles(job.Input, job.Output)
+
+	w.log.Debug("running job on worker", "correlation_id", correlationID(ctx), "execution_id", job.ID, "jobs", w.jobs)
+	execErr := w.run(ctx, job)
+	recordWorker(ctx, w)
+	if execErr != nil {
+		// log the head of the payload that could not be converted for debugging purposes, it is kept out of the error
+		// as the error is replied to the caller and recorded in the history
+		w.log.Warn("job failed", "correlation_id", correlationID(ctx), "execution_id", job.ID, "head_of_payload", getHead(payload, 200), "error", execErr)
+		return nil, execErr
+	}
+
+	return readOutput(job.Output)
+}
+
+// StopWorkers stops the workers of all the plugins, it is called on shutdown once no conversion is running anymore.
+// The workers that are still running when ctx is done are killed.
+func StopWorkers(ctx context.Context) {
+	pools.mu.Lock()
+	all := slices.Collect(maps.Values(pools.pools))
+	pools.pools = map[string]*workerPool{}
+	pools.mu.Unlock()
+
+	var stopped []*worker
+	for _, pool := range all {
+		pool.closed.Store(true)
+		for range len(pool.idle) {
+			select {
+			case w := <-pool.idle:
+				pool.discard(w)
+				stopped = append(stopped, w)
+			default:
+			}
+		}
+	}
+	for _, w := range stopped {
+		select {
+		case <-w.done:
+		case <-ctx.Done():
+			w.log.Warn("worker still running at shutdown, killing it")
+			w.kill()
+		}
+	}
+	log.Info("workers stopped", "workers", len(stopped))
+}
+
+// workerPools holds the pool of workers of each plugin
+type workerPools struct {
+	mu     sync.Mutex
+	pools  map[string]*workerPool
+	reaper sync.Once
+}
+
+// get returns the pool of the plugin. When the definition of the plugin changed, its old workers are retired and a new
+// pool is created.
+func (p *workerPools) get(runtime Runtime, plugin model.Plugin) *workerPool {
+	fingerprint, _ := json.Marshal(plugin)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	pool, ok := p.pools[plugin.ID]
+	if ok && pool.fingerprint == string(fingerprint) {
+		return pool
+	}
+	if ok {
+		log.Info("plugin changed, retiring its workers", "plugin_id", plugin.ID)
+		pool.close()
+	}
+	pool = &workerPool{
+		runtime:     runtime,
+		plugin:      plugin,
+		fingerprint: string(fingerprint),
+		idle:        make(chan *worker, workerPoolSize),
+		slots:       make(chan struct{}, workerPoolSize),
+	}
+	p.pools[plugin.ID] = pool
+	p.reaper.Do(func() { go p.reapIdle() })
+	return pool
+}
+
+// reapIdle periodically stops the workers that have been idle for too long
+func (p *workerPools) reapIdle() {
+	ticker := time.NewTicker(max(workerIdleTimeout/4, time.Second))
+	defer ticker.Stop()
+	for range ticker.C {
+		p.mu.Lock()
+		pools := slices.Collect(maps.Values(p.pools))
+		p.mu.Unlock()
+
+		for _, pool := range pools {
+			pool.reapIdle()
+		}
+	}
+}
+
+// workerPool holds up to workerPoolSize workers of a plugin
+type workerPool struct {
+	runtime     Runtime
+	plugin      model.Plugin
+	fingerprint string
+	// the workers waiting for a job
+	idle chan *worker
+	// a slot is taken for each running worker, busy or idle
+	slots  chan struct{}
+	closed atomic.Bool
+}
+
+// acquire returns an idle worker, or starts a new one if the pool is not full. Otherwise it waits for a worker to be
+// released.
+func (p *workerPool) acquire(ctx context.Context) (*worker, error) {
+	for {
+		// prefer an idle worker to starting a new one
+		select {
+		case w := <-p.idle:
+			if w.exited() {
+				p.discard(w)
+				continue
+			}
+			return w, nil
+		default:
+		}
+
+		select {
+		case w := <-p.idle:
+			if w.exited() {
+				p.discard(w)
+				continue
+			}
+			return w, nil
+		case p.slots <- struct{}{}:
+			w, err := startWorker(p.runtime, p.plugin)
+			if err != nil {
+				<-p.slots
+				return nil, err
+			}
+			return w, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// release gives back a worker after a job, stopping it if it is not fit for another one
+func (p *workerPool) release(w *worker) {
+	w.jobs++
+	if p.closed.Load() || w.exited() || w.jobs >= workerMaxJobs || !w.cpuLeft() {
+		p.discard(w)
+		return
+	}
+	w.lastUsed = time.Now()
+	p.idle <- w
+	// the pool may have been closed in the meantime, and nothing would reap it anymore
+	if p.closed.Load() {
+		p.reapIdle()
+	}
+}
+
+// discard stops the worker and frees its slot
+func (p *workerPool) discard(w *worker) {
+	w.stop()
+	<-p.slots
+}
+
+// reapIdle stops the idle workers that have been idle for too long, or all of them if the pool is closed
+func (p *workerPool) reapIdle() {
+	for range len(p.idle) {
+		select {
+		case w := <-p.idle:
+			if p.closed.Load() || w.exited() || time.Since(w.lastUsed) > workerIdleTimeout {
+				w.log.Debug("stopping idle worker", "idle", time.Since(w.lastUsed))
+				p.discard(w)
+				continue
+			}
+			p.idle <- w
+		default:
+			return
+		}
+	}
+}
+
+// close stops the idle workers of the pool, the busy ones are stopped when released
+func (p *workerPool) close() {
+	p.closed.Store(true)
+	p.reapIdle()
+}
+
+// worker is a running process of a plugin using the worker protocol
+type worker struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+	// the frames written by the worker, closed when its stdout is closed
+	results chan workerResult
+	// the stderr of the current job, reset when a job is sent
+	stderr *tailBuffer
+	// the absolute path of the directory where the files of the jobs are written
+	dir    string
+	limits *limitGuard
+	log    *slog.Logger
+	// closed once the process has exited, waitErr is then the error returned by Wait
+	done     chan struct{}
+	waitErr  error
+	stopOnce sync.Once
+
+	// only used by the pool
+	jobs     int
+	lastUsed time.Time
+}
+
+func startWorker(runtime Runtime, plugin model.Plugin) (*worker, error) {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("error getting current directory: %w", err)
+	}
+	dirName, err := getUniqueFileName(currentDir)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(currentDir, dirName)
+	if err := os.Mkdir(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("error creating the worker directory: %w", err)
+	}
+
+	// the worker outlives the job that started it
+	cmd, err := runtime.Command(context.Background(), plugin, "", "")
+	if err != nil {
+		cleanupTempFiles(dir)
+		return nil, err
+	}
+
+	w := &worker{
+		cmd:     cmd,
+		results: make(chan workerResult, 1),
+		stderr:  newTailBuffer(outputLimit),
+		dir:     dir,
+		log:     log.With("plugin_id", plugin.ID, "worker_id", dirName),
+		done:    make(chan struct{}),
+	}
+	stderrLog := newLineLogger(w.log.With("stream", "stderr"), slog.LevelWarn, outputLimit)
+	cmd.Stderr = io.MultiWriter(w.stderr, stderrLog)
+	if w.stdin, err = cmd.StdinPipe(); err != nil {
+		cleanupTempFiles(dir)
+		return nil, fmt.Errorf("error creating the worker stdin: %w", err)
+	}
+	// not using StdoutPipe, as Wait would close it before the last frames are read
+	stdout, stdoutWriter, err := os.Pipe()
+	if err != nil {
+		cleanupTempFiles(dir)
+		return nil, fmt.Errorf("error creating the worker stdout: %w", err)
+	}
+	cmd.Stdout = stdoutWriter
+
+	if w.limits, err = prepareProcess(cmd, plugin, currentDir, dirName, workerMaxJobs); err != nil {
+		_ = stdout.Close()
+		_ = stdoutWriter.Close()
+		cleanupTempFiles(dir)
+		return nil, err
+	}
+	cmd.Env = append(cmd.Environ(), workerProtocolEnv)
+
+	err = cmd.Start()
+	_ = stdoutWriter.Close()
+	if err != nil {
+		_ = stdout.Close()
+		w.limits.release()
+		cleanupTempFiles(dir)
+		return nil, fmt.Errorf("error starting the worker: %w", err)
+	}
+	w.log.Info("worker started", "pid", cmd.Process.Pid)
+
+	go w.readResults(stdout)
+	go func() {
+		w.waitErr = cmd.Wait()
+		// reap whatever the worker left running in its process group
+		_ = killProcessGroup(cmd.Process)
+		stderrLog.flush()
+		w.log.Info("worker exited", "exit_code", cmd.ProcessState.ExitCode())
+		w.limits.release()
+		cleanupTempFiles(dir)
+		close(w.done)
+	}()
+	return w, nil
+}
+
+func (w *worker) readResults(stdout io.ReadCloser) {
+	defer close(w.results)
+	defer stdout.Close()
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 0, 4096), maxFrameSize)
+	for scanner.Scan() {
+		var result workerResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			w.log.Error("invalid frame written by worker, killing it", "frame", getHead(scanner.Text(), 200), "error", err)
+			w.kill()
+			return
+		}
+		w.results <- result
+	}
+	if err := scanner.Err(); err != nil {
+		w.log.Error("error reading worker stdout, killing it", "error", err)
+		w.kill()
+	}
+}
+
+// run sends the job to the worker and waits for its result
+func (w *worker) run(ctx context.Context, job workerJob) *ExecutionError {
+	frame, err := json.Marshal(job)
+	if err != nil {
+		return &ExecutionError{Err: fmt.Errorf("error encoding the job: %w", err)}
+	}
+	w.stderr.reset()
+
+	// the CPU time limit of the worker is the one of all its jobs, the one of this job is checked while it runs
+	var cpuCheck <-chan time.Time
+	var cpuStart time.Duration
+	if w.limits.jobCPU() > 0 {
+		if cpuStart, err = w.limits.cpuTime(w.cmd.Process.Pid); err != nil {
+			w.log.Warn("can't read the CPU time of the worker, only its total CPU time is limited", "error", err)
+		} else {
+			ticker := time.NewTicker(cpuCheckInterval)
+			defer ticker.Stop()
+			cpuCheck = ticker.C
+		}
+	}
+
+	if _, err := w.stdin.Write(append(frame, '\n')); err != nil {
+		w.kill()
+		return w.exitError(ctx)
+	}
+
+	for {
+		select {
+		case <-cpuCheck:
+			used, err := w.limits.cpuTime(w.cmd.Process.Pid)
+			if err == nil && used-cpuStart >= w.limits.jobCPU() {
+				w.limits.cpuExceeded.Store(true)
+				w.kill()
+				return w.exitError(ctx)
+			}
+		case result, ok := <-w.results:
+			if !ok {
+				return w.exitError(ctx)
+			}
+			if result.ID != job.ID {
+				w.log.Warn("ignoring result of another job", "expected", job.ID, "got", result.ID)
+				continue
+			}
+			if result.Error != "" {
+				return &ExecutionError{
+					Err:    fmt.Errorf("error executing the plugin: %s", result.Error),
+					Stderr: w.stderr.tail(stderrTailLength),
+				}
+			}
+			return nil
+		case <-ctx.Done():
+			w.kill()
+			return w.exitError(ctx)
+		}
+	}
+}
+
+// exitError waits for the worker to exit and returns why it failed
+func (w *worker) exitError(ctx context.Context) *ExecutionError {
+	<-w.done
+	err := w.waitErr
+	if err == nil {
+		err = errWorkerExited
+	}
+	return processError(ctx, w.cmd.ProcessState, err, w.limits, w.stderr)
+}
+
+// cpuLeft reports whether the worker can run another job without its CPU time limit, that of all its jobs, being
+// reached before the one of the job
+func (w *worker) cpuLeft() bool {
+	if w.limits.jobCPU() == 0 {
+		return true
+	}
+	used, err := w.limits.cpuTime(w.cmd.Process.Pid)
+	if err != nil {
+		return true
+	}
+	return w.limits.cpuBudget()-used >= w.limits.jobCPU()
+}
+
+func (w *worker) exited() bool {
+	select {
+	case <-w.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// stop asks the worker to exit by closing its stdin, and kills it if it is still running after killWaitDelay
+func (w *worker) stop() {
+	w.stopOnce.Do(func() {
+		_ = w.stdin.Close()
+		go func() {
+			select {
+			case <-w.done:
+			case <-time.After(killWaitDelay):
+				w.log.Warn("worker did not exit after closing its stdin, killing it")
+				w.kill()
+			}
+		}()
+	})
+}
+
+func (w *worker) kill() {
+	_ = killProcessGroup(w.cmd.Process)
+}
@@ -0,0 +1,48 @@
+// Package env reads the configuration of the service from the environment variables, logging the defaults it falls
+// back to.
+package env
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/epos-eu/converter-service/logging"
+)
+
+var log = logging.Get("env")
+
+// Get returns the value of the variable k, or def when it is not set
+func Get(k, def string) string {
+	if v, ok := os.LookupEnv(k); ok {
+		log.Debug("environment variable found", "name", k, "value", v)
+		return v
+	}
+	log.Info("env variable not found, using default", "name", k, "default", def)
+	return def
+}
+
+// Int returns the integer value of the variable key, or defaultVal when it is not set, empty or not an integer
+func Int(key string, defaultVal int) int {
+	strVal := Get(key, strconv.FormatInt(int64(defaultVal), 10))
+	if strVal == "" {
+		log.Debug("environment variable not set, using default", "name", key, "default", defaultVal)
+		return defaultVal
+	}
+
+	val, err := strconv.Atoi(strVal)
+	if err != nil {
+		log.Warn("invalid integer value, using default", "name", key, "value", strVal, "error", err, "default", defaultVal)
+		return defaultVal
+	}
+
+	return val
+}
+
+// Secret is Get for secrets, their value is never logged
+func Secret(key, def string) string {
+	if v, ok := os.LookupEnv(key); ok {
+		log.Debug("environment variable found", "name", key)
+		return v
+	}
+	return def
+}
@@ -0,0 +1,260 @@
+// Package jobs runs asynchronous conversions. A job is run by the replica that created it, its state and its result are
+// stored in the conversion_job table, so that any replica can report them.
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/db"
+	"github.com/epos-eu/converter-service/handler"
+	"github.com/epos-eu/converter-service/internal/env"
+	"github.com/epos-eu/converter-service/logging"
+	"github.com/google/uuid"
+)
+
+var (
+	log = logging.Get("jobs")
+
+	concurrency   = 2
+	resultTTL     = 24 * time.Hour
+	cancelPoll    = 5 * time.Second
+	purgeInterval = time.Minute
+
+	// the replica running the jobs it creates
+	owner, _ = os.Hostname()
+
+	// a slot is taken by each running job
+	slots chan struct{}
+	// the cancel function of the jobs of the replica that are not finished
+	running   = map[string]context.CancelFunc{}
+	runningMu sync.Mutex
+	// the jobs of the replica that are not finished
+	unfinished sync.WaitGroup
+
+	// ErrBadMessage is returned by Submit when the message of the job is not valid
+	ErrBadMessage = errors.New("invalid conversion message")
+	// ErrJobFinished is returned by Cancel when the job is already finished
+	ErrJobFinished = errors.New("the job is already finished")
+)
+
+func init() {
+	concurrency = max(env.Int("JOB_CONCURRENCY", concurrency), 1)
+	resultTTL = time.Duration(env.Int("JOB_RESULT_TTL", int(resultTTL.Seconds()))) * time.Second
+	slots = make(chan struct{}, concurrency)
+}
+
+// Start fails the jobs left unfinished by a previous run of the replica, and purges the expired jobs until ctx is done
+func Start(ctx context.Context) {
+	now := time.Now()
+	interrupted, err := db.FailJobsOfOwner(owner, model.JobError{
+		Code:    string(handler.CodeInternal),
+		Message: "the job was interrupted by a restart of the converter-service",
+	}, now, now.Add(resultTTL))
+	if err != nil {
+		log.Error("error failing the interrupted jobs", "error", err)
+	} else if interrupted > 0 {
+		log.Warn("jobs interrupted by a restart failed", "count", interrupted)
+	}
+
+	go func() {
+		ticker := time.NewTicker(purgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				purged, err := db.DeleteExpiredJobs(time.Now())
+				if err != nil {
+					log.Error("error purging the expired jobs", "error", err)
+				} else if purged > 0 {
+					log.Info("expired jobs purged", "count", purged)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Submit creates a job converting the message, a message of the map queue, and runs it in the background
+func Submit(message []byte) (model.ConversionJob, error) {
+	var msg handler.Message
+	if err := json.Unmarshal(message, &msg); err != nil {
+		return model.ConversionJob{}, fmt.Errorf("%w: %w", ErrBadMessage, err)
+	}
+
+	now := time.Now()
+	// a job left unfinished by a replica that crashed expires too
+	expiresAt := now.Add(resultTTL)
+	job, err := db.CreateJob(model.ConversionJob{
+		ID:             uuid.NewString(),
+		State:          model.JobQueued,
+		DistributionID: msg.Parameters.DistributionID,
+		PluginID:       msg.Parameters.PluginID,
+		PipelineID:     msg.Parameters.PipelineID,
+		Owner:          owner,
+		CreatedAt:      now,
+		ExpiresAt:      &expiresAt,
+	})
+	if err != nil {
+		return job, fmt.Errorf("error creating the job: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runningMu.Lock()
+	running[job.ID] = cancel
+	runningMu.Unlock()
+
+	unfinished.Add(1)
+	go func() {
+		defer unfinished.Done()
+		defer func() {
+			runningMu.Lock()
+			delete(running, job.ID)
+			runningMu.Unlock()
+			cancel()
+		}()
+		run(ctx, job, message)
+	}()
+	log.Info("job submitted", "job_id", job.ID, "plugin_id", job.PluginID, "pipeline_id", job.PipelineID, "distribution_id", job.DistributionID)
+	return job, nil
+}
+
+// run waits for a slot and runs the conversion of the job, unless it is cancelled
+func run(ctx context.Context, job model.ConversionJob, message []byte) {
+	select {
+	case slots <- struct{}{}:
+		defer func() { <-slots }()
+	case <-ctx.Done():
+		return
+	}
+
+	started, err := db.StartJob(job.ID, time.Now())
+	if err != nil {
+		log.Error("error starting the job", "job_id", job.ID, "error", err)
+		return
+	}
+	if !started {
+		log.Info("job cancelled before it started", "job_id", job.ID)
+		return
+	}
+
+	// the job can be cancelled by another replica, which only changes its state
+	go watchCancel(ctx, job.ID)
+
+	log.Info("job started", "job_id", job.ID)
+	start := time.Now()
+	ctx = handler.WithCorrelationID(ctx, job.ID)
+	resp, err := handler.ExternalAccessHandler(ctx, message)
+
+	finishedAt := time.Now()
+	expiresAt := finishedAt.Add(resultTTL)
+	job.FinishedAt, job.ExpiresAt = &finishedAt, &expiresAt
+	if err != nil {
+		reply := handler.NewErrorReply(err)
+		job.State = model.JobFailed
+		job.Error = &model.JobError{
+			Code:     string(reply.Error.Code),
+			Message:  reply.Error.Message,
+			PluginID: reply.Error.PluginID,
+			Stderr:   reply.Error.Stderr,
+		}
+	} else {
+		job.State = model.JobSucceeded
+		job.Result = resp
+	}
+
+	finished, err := db.FinishJob(job)
+	if err != nil {
+		log.Error("error saving the job result", "job_id", job.ID, "error", err)
+		return
+	}
+	if !finished {
+		log.Info("job cancelled", "job_id", job.ID, "duration", time.Since(start))
+		return
+	}
+	log.Info("job finished", "job_id", job.ID, "state", job.State, "duration", time.Since(start))
+}
+
+// watchCancel cancels ctx once the job is cancelled in the db
+func watchCancel(ctx context.Context, id string) {
+	ticker := time.NewTicker(cancelPoll)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			state, err := db.GetJobState(id)
+			if err != nil {
+				log.Warn("error checking the state of the job", "job_id", id, "error", err)
+				continue
+			}
+			if state == model.JobCancelled {
+				cancelLocal(id)
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Cancel cancels a job that is not finished. Its plugin is killed if it is running on this replica, otherwise the
+// replica running it kills it within cancelPoll.
+func Cancel(id string) error {
+	now := time.Now()
+	expiresAt := now.Add(resultTTL)
+	cancelled, err := db.FinishJob(model.ConversionJob{ID: id, State: model.JobCancelled, FinishedAt: &now, ExpiresAt: &expiresAt})
+	if err != nil {
+		return fmt.Errorf("error cancelling the job: %w", err)
+	}
+	if !cancelled {
+		return ErrJobFinished
+	}
+	cancelLocal(id)
+	log.Info("job cancelled", "job_id", id)
+	return nil
+}
+
+func cancelLocal(id string) {
+	runningMu.Lock()
+	defer runningMu.Unlock()
+	if cancel, ok := running[id]; ok {
+		cancel()
+	}
+}
+
+// Shutdown waits for the jobs of the replica to finish until ctx is done, then cancels and fails the ones left
+func Shutdown(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		unfinished.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+	}
+
+	runningMu.Lock()
+	log.Warn("jobs still running at shutdown, cancelling them", "count", len(running))
+	for _, cancel := range running {
+		cancel()
+	}
+	runningMu.Unlock()
+
+	now := time.Now()
+	_, err := db.FailJobsOfOwner(owner, model.JobError{
+		Code:    string(handler.CodeInternal),
+		Message: "the job was interrupted by the shutdown of the converter-service",
+	}, now, now.Add(resultTTL))
+	if err != nil {
+		log.Error("error failing the interrupted jobs", "error", err)
+	}
+}
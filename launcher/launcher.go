@@ -0,0 +1,139 @@
+// Package launcher prepares the process of a plugin before the plugin itself starts running.
+//
+// The converter-service does not start a limited plugin directly: it starts the plugin-launcher binary with a Spec in
+// its environment. The launcher applies the Spec to its own process and then replaces itself with the plugin, so that
+// the plugin is limited from its very first instruction.
+//
+// A sandboxed plugin is started by the service in new user, mount and PID namespaces, the launcher then builds the
+// filesystem of the sandbox and drops every capability before executing the plugin.
+//
+// This package is also imported by the plugin-launcher binary, so it must not write anything on stdout or stderr
+// before the plugin is executed.
+package launcher
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+)
+
+// SpecEnv is the environment variable used to pass the Spec to the launcher
+const SpecEnv = "CONVERTER_LAUNCHER_SPEC"
+
+// Rlimit is a resource limit set with setrlimit before executing the plugin
+type Rlimit struct {
+	Resource int    `json:"resource"`
+	Cur      uint64 `json:"cur"`
+	Max      uint64 `json:"max"`
+}
+
+// Spec describes how the launcher has to prepare the plugin process
+type Spec struct {
+	// the program of the plugin and its full argv
+	Path string   `json:"path"`
+	Args []string `json:"args"`
+	// the resource limits to apply
+	Rlimits []Rlimit `json:"rlimits,omitempty"`
+	// the sandbox to set up, nil to run the plugin outside of any sandbox
+	Sandbox *Sandbox `json:"sandbox,omitempty"`
+}
+
+// IsZero reports whether the spec has nothing to apply, in which case the launcher is not needed
+func (s Spec) IsZero() bool {
+	return len(s.Rlimits) == 0 && s.Sandbox == nil
+}
+
+// Sandbox is the filesystem seen by a plugin running in its own mount and PID namespaces
+type Sandbox struct {
+	// directories covered by an empty read-only tmpfs, only the ReadOnly and Writable directories inside of them are
+	// mounted back
+	Hidden []string `json:"hidden,omitempty"`
+	// directories bind mounted read-only on themselves
+	ReadOnly []string `json:"read_only,omitempty"`
+	// directories bind mounted read-write on themselves, after the read-only ones so that they can be inside of them
+	Writable []string `json:"writable,omitempty"`
+	// make every mount read-only before mounting the ReadOnly and Writable directories, so that the plugin can only
+	// write to the Writable ones and to the private /tmp
+	ReadOnlyRoot bool `json:"read_only_root,omitempty"`
+	// mount an empty tmpfs on /tmp
+	PrivateTmp bool `json:"private_tmp,omitempty"`
+	// mount a /proc showing the processes of the PID namespace of the plugin only
+	PrivateProc bool `json:"private_proc,omitempty"`
+}
+
+// Wrap rewrites cmd so that it starts the launcher found at launcherPath, which applies spec and then executes the
+// original command of cmd. It must be called after the arguments of cmd are final.
+func Wrap(cmd *exec.Cmd, launcherPath string, spec Spec) error {
+	if cmd.Process != nil {
+		return fmt.Errorf("can't wrap a command that has already been started")
+	}
+	if _, err := os.Stat(launcherPath); err != nil {
+		return fmt.Errorf("plugin launcher not available: %w", err)
+	}
+
+	spec.Path = cmd.Path
+	spec.Args = cmd.Args
+	encoded, err := json.Marshal(spec)
+	if err != nil {
+		return fmt.Errorf("error encoding launcher spec: %w", err)
+	}
+
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	cmd.Env = append(env, SpecEnv+"="+string(encoded))
+	cmd.Path = launcherPath
+	cmd.Args = []string{launcherPath}
+	return nil
+}
+
+// Main applies the Spec found in the environment and executes the plugin. It only returns on failure.
+func Main() error {
+	raw, ok := os.LookupEnv(SpecEnv)
+	if !ok {
+		return fmt.Errorf("%s is not set, the launcher must be started by the converter-service", SpecEnv)
+	}
+	// the plugin must not see its own spec
+	if err := os.Unsetenv(SpecEnv); err != nil {
+		return fmt.Errorf("error clearing the launcher spec: %w", err)
+	}
+
+	var spec Spec
+	if err := json.Unmarshal([]byte(raw), &spec); err != nil {
+		return fmt.Errorf("error decoding launcher spec: %w", err)
+	}
+	if spec.Path == "" || len(spec.Args) == 0 {
+		return fmt.Errorf("invalid launcher spec: no command to execute")
+	}
+
+	for _, l := range spec.Rlimits {
+		if err := syscall.Setrlimit(l.Resource, &syscall.Rlimit{Cur: l.Cur, Max: l.Max}); err != nil {
+			return fmt.Errorf("error setting rlimit %d: %w", l.Resource, err)
+		}
+	}
+
+	if spec.Sandbox != nil {
+		// capabilities are per thread, the plugin must be executed from the thread that dropped them
+		runtime.LockOSThread()
+		if err := spec.Sandbox.setup(); err != nil {
+			return fmt.Errorf("error setting up the sandbox: %w", err)
+		}
+		if err := dropPrivileges(); err != nil {
+			return fmt.Errorf("error dropping privileges: %w", err)
+		}
+	}
+
+	path := spec.Path
+	if !strings.Contains(path, "/") {
+		var err error
+		if path, err = exec.LookPath(spec.Path); err != nil {
+			return fmt.Errorf("error looking up %s: %w", spec.Path, err)
+		}
+	}
+	return syscall.Exec(path, spec.Args, os.Environ())
+}
@@ -0,0 +1,188 @@
+//go:build linux
+
+package launcher
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// flags of statfs (ST_*) that have to be kept when remounting a bind mount, mapped to the MS_* ones. In a user
+// namespace the kernel refuses a remount that would clear them.
+var lockedFlags = map[int64]uintptr{
+	0x0002: syscall.MS_NOSUID,
+	0x0004: syscall.MS_NODEV,
+	0x0008: syscall.MS_NOEXEC,
+	0x0400: syscall.MS_NOATIME,
+	0x0800: syscall.MS_NODIRATIME,
+	0x1000: syscall.MS_RELATIME,
+}
+
+func (s *Sandbox) setup() error {
+	wd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("error getting the working directory: %w", err)
+	}
+
+	// nothing mounted in the sandbox must propagate back to the service
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("error making the mounts private: %w", err)
+	}
+
+	// the directories mounted back are opened before being hidden, to be bind mounted from their descriptor
+	sources := map[string]int{}
+	defer func() {
+		for _, fd := range sources {
+			_ = syscall.Close(fd)
+		}
+	}()
+	for _, dir := range append(append([]string{}, s.ReadOnly...), s.Writable...) {
+		fd, err := syscall.Open(dir, syscall.O_RDONLY|syscall.O_DIRECTORY|syscall.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("error opening %s: %w", dir, err)
+		}
+		sources[dir] = fd
+	}
+	for _, dir := range s.Hidden {
+		if err := syscall.Mount("tmpfs", dir, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=0755"); err != nil {
+			return fmt.Errorf("error hiding %s: %w", dir, err)
+		}
+	}
+	// the mount points inside of the hidden directories are created before they become read-only
+	for dir := range sources {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return fmt.Errorf("error creating the mount point %s: %w", dir, err)
+		}
+	}
+	for _, dir := range s.Hidden {
+		if err := syscall.Mount("", dir, "", syscall.MS_REMOUNT|syscall.MS_RDONLY|syscall.MS_NOSUID|syscall.MS_NODEV, ""); err != nil {
+			return fmt.Errorf("error making %s read-only: %w", dir, err)
+		}
+	}
+	if s.ReadOnlyRoot {
+		if err := readOnlyMounts("/"); err != nil {
+			return err
+		}
+	}
+
+	for _, dir := range s.ReadOnly {
+		if err := bindMount(sources[dir], dir, true); err != nil {
+			return err
+		}
+	}
+	for _, dir := range s.Writable {
+		if err := bindMount(sources[dir], dir, false); err != nil {
+			return err
+		}
+	}
+	if s.PrivateTmp {
+		if err := syscall.Mount("tmpfs", "/tmp", "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV, "mode=1777"); err != nil {
+			return fmt.Errorf("error mounting the private /tmp: %w", err)
+		}
+	}
+	// last, as the bind mounts above go through /proc/self/fd
+	if s.PrivateProc {
+		if err := syscall.Mount("proc", "/proc", "proc", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+			return fmt.Errorf("error mounting the private /proc: %w", err)
+		}
+	}
+
+	// the working directory still points to the directory below the new mounts
+	if err := os.Chdir(wd); err != nil {
+		return fmt.Errorf("error entering the working directory: %w", err)
+	}
+	return nil
+}
+
+// bindMount mounts the directory opened as fd on dir
+func bindMount(fd int, dir string, readOnly bool) error {
+	source := "/proc/self/fd/" + strconv.Itoa(fd)
+	if err := syscall.Mount(source, dir, "", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("error bind mounting %s: %w", dir, err)
+	}
+
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(dir, &fs); err != nil {
+		return fmt.Errorf("error reading the mount flags of %s: %w", dir, err)
+	}
+	flags := uintptr(syscall.MS_REMOUNT | syscall.MS_BIND)
+	for st, ms := range lockedFlags {
+		if fs.Flags&st != 0 {
+			flags |= ms
+		}
+	}
+	if readOnly {
+		flags |= syscall.MS_RDONLY
+	}
+	if err := syscall.Mount("", dir, "", flags, ""); err != nil {
+		return fmt.Errorf("error remounting %s (read-only: %t): %w", dir, readOnly, err)
+	}
+	return nil
+}
+
+// readOnlyMounts makes the mount of dir and every mount below it read-only. Unlike a remount, mount_setattr changes
+// the whole tree at once and leaves the other flags alone, which the kernel would refuse to clear in a user namespace.
+func readOnlyMounts(dir string) error {
+	const (
+		sysMountSetattr = 442
+		atFdcwd         = -100
+		atRecursive     = 0x8000
+		mountAttrRdonly = 0x1
+	)
+	// struct mount_attr
+	attr := struct {
+		set, clr, propagation, usernsFd uint64
+	}{set: mountAttrRdonly}
+
+	path, err := syscall.BytePtrFromString(dir)
+	if err != nil {
+		return err
+	}
+	dirfd := atFdcwd
+	_, _, errno := syscall.Syscall6(sysMountSetattr, uintptr(dirfd), uintptr(unsafe.Pointer(path)), atRecursive,
+		uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("error making the mounts below %s read-only: %w", dir, errno)
+	}
+	return nil
+}
+
+// dropPrivileges makes sure that the plugin gets no capability in the sandbox, so that it can't undo the mounts.
+// The plugin runs as root of the user namespace, which would give it every capability on exec.
+func dropPrivileges() error {
+	const (
+		prCapbsetDrop     = 24
+		prSetSecurebits   = 28
+		prSetNoNewPrivs   = 38
+		secbitNoroot      = 1 << 0
+		secbitNorootLock  = 1 << 1
+		secbitNoSetuidFix = 1 << 2
+	)
+
+	content, err := os.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return fmt.Errorf("error reading the last capability: %w", err)
+	}
+	lastCap, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return fmt.Errorf("error parsing the last capability: %w", err)
+	}
+	for c := 0; c <= lastCap; c++ {
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prCapbsetDrop, uintptr(c), 0); errno != 0 {
+			return fmt.Errorf("error dropping capability %d: %w", c, errno)
+		}
+	}
+	// being root must not give back any capability on exec
+	securebits := uintptr(secbitNoroot | secbitNorootLock | secbitNoSetuidFix)
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetSecurebits, securebits, 0); errno != 0 {
+		return fmt.Errorf("error setting the securebits: %w", errno)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0); errno != 0 {
+		return fmt.Errorf("error setting no_new_privs: %w", errno)
+	}
+	return nil
+}
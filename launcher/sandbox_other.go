@@ -0,0 +1,13 @@
+//go:build !linux
+
+package launcher
+
+import "fmt"
+
+func (s *Sandbox) setup() error {
+	return fmt.Errorf("the sandbox is only available on linux")
+}
+
+func dropPrivileges() error {
+	return fmt.Errorf("the sandbox is only available on linux")
+}
@@ -2,31 +2,204 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"flag"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"github.com/epos-eu/converter-service/db"
+	"github.com/epos-eu/converter-service/handler"
+	"github.com/epos-eu/converter-service/internal/env"
+	"github.com/epos-eu/converter-service/jobs"
+	"github.com/epos-eu/converter-service/logging"
 	"github.com/epos-eu/converter-service/rabbit"
 	"github.com/epos-eu/converter-service/server"
+	"github.com/epos-eu/converter-service/server/routes"
+	"github.com/epos-eu/converter-service/tracing"
+	"github.com/epos-eu/converter-service/transport"
 )
 
+var (
+	// how long the in-flight conversions are waited for on shutdown
+	shutdownTimeout = 25 * time.Second
+	log             = logging.Get("main")
+
+	transportFlag = flag.String("transport", "amqp", "the transport of the messages: amqp, or memory to handle the messages of -input and exit")
+	inputFlag     = flag.String("input", "-", "with -transport=memory, a directory holding a message per file, or - to read a message per line from stdin")
+	queueFlag     = flag.String("queue", transport.QueueMap, "with -transport=memory, the queue of the messages: map or resources")
+)
+
+func init() {
+	shutdownTimeout = time.Duration(env.Int("SHUTDOWN_TIMEOUT", int(shutdownTimeout.Seconds()))) * time.Second
+}
+
 func main() {
+	flag.Parse()
+
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
+	if err := tracing.Init(ctx); err != nil {
+		panic("failed to set up tracing: " + err.Error())
+	}
+
+	if err := handler.LoadRuntimes(); err != nil {
+		panic("failed to load the runtimes: " + err.Error())
+	}
+
 	if err := db.Init(); err != nil {
 		panic("failed to connect to database: " + err.Error())
 	}
 
-	broker := rabbit.NewBroker()
-	// start the broker handling
-	err := broker.Start()
+	switch *transportFlag {
+	case "amqp":
+	case "memory":
+		err := runMemory(ctx)
+		shutdown(nil, nil)
+		if err != nil {
+			panic(err)
+		}
+		return
+	default:
+		panic("unknown transport " + *transportFlag)
+	}
+
+	// fail the jobs interrupted by a restart and purge the expired ones
+	jobs.Start(ctx)
+
+	// purge the execution history past its retention
+	handler.StartExecutionPurge(ctx)
+
+	// run the fixtures of the plugins synced by the converter-routine
+	routes.WatchSyncs(ctx)
+
+	broker := rabbit.NewBroker(transport.DefaultHandlers())
+	// start the broker handling, the connection is monitored and automatically restarted (in place), it only fails on an
+	// invalid configuration
+	err := broker.Start(ctx)
 	if err != nil {
 		panic(err)
 	}
-	// start to monitor the connection and automatically restart it (in place)
-	go broker.Monitor(ctx)
 
-	server.StartServer(broker)
+	srv := server.StartServer(broker)
+
+	<-ctx.Done()
+	stop()
+	shutdown(broker, srv)
+}
+
+// runMemory handles the messages of the input with the memory transport, and writes their results to stdout
+func runMemory(ctx context.Context) error {
+	var mu sync.Mutex
+	out := json.NewEncoder(os.Stdout)
+	memory := transport.NewMemory(transport.DefaultHandlers(), 1, func(result transport.Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := out.Encode(result); err != nil {
+			log.Error("error writing the result", "correlation_id", result.CorrelationID, "error", err)
+		}
+	})
+	if err := memory.Start(ctx); err != nil {
+		return err
+	}
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		if err := memory.Shutdown(shutdownCtx); err != nil {
+			log.Error("error shutting down the memory transport", "error", err)
+		}
+	}()
+
+	var err error
+	if *inputFlag == "-" {
+		err = memory.PublishLines(ctx, *queueFlag, os.Stdin)
+	} else {
+		err = memory.PublishDir(ctx, *queueFlag, *inputFlag)
+	}
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		memory.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// the shares of shutdownTimeout after which each stage of the shutdown is cut short
+const (
+	// the messages, the requests and the jobs in progress are waited for
+	drainShare = 0.7
+	// the plugins still running are killed
+	killShare = 0.85
+)
+
+// shutdown stops taking new messages and requests, waits for the conversions in progress, kills the plugins that are
+// still running, then releases the resources of the service. Each stage has its own deadline, all within
+// shutdownTimeout, so that a stage running late doesn't take the time of the following ones.
+func shutdown(t transport.Transport, srv *http.Server) {
+	log.Info("shutting down", "timeout", shutdownTimeout)
+	start := time.Now()
+	stage := func(share float64) (context.Context, context.CancelFunc) {
+		return context.WithDeadline(context.Background(), start.Add(time.Duration(share*float64(shutdownTimeout))))
+	}
+
+	// the transport and the server both stop their intake right away, then drain at the same time
+	var drain sync.WaitGroup
+	if t != nil {
+		drain.Go(func() {
+			ctx, cancel := stage(drainShare)
+			defer cancel()
+			if err := t.Shutdown(ctx); err != nil {
+				log.Error("error shutting down the transport", "error", err)
+			}
+		})
+	}
+	drain.Go(func() {
+		// the server waits for the synchronous conversions, and no job can be created once it is shut down
+		if srv != nil {
+			ctx, cancel := stage(drainShare)
+			defer cancel()
+			if err := srv.Shutdown(ctx); err != nil {
+				log.Error("error shutting down the server", "error", err)
+			}
+		}
+		ctx, cancel := stage(drainShare)
+		defer cancel()
+		jobs.Shutdown(ctx)
+	})
+	drain.Go(func() {
+		ctx, cancel := stage(drainShare)
+		defer cancel()
+		routes.ShutdownSyncs(ctx)
+	})
+	drain.Wait()
+
+	// whatever is still converting is cut short, so that no process group nor temp dir outlives the service
+	killCtx, cancelKill := stage(killShare)
+	handler.KillExecutions(killCtx)
+	cancelKill()
+
+	ctx, cancel := stage(1)
+	defer cancel()
+	handler.StopWorkers(ctx)
+	if err := db.Close(); err != nil {
+		log.Error("error closing the database", "error", err)
+	}
+	if err := tracing.Shutdown(ctx); err != nil {
+		log.Error("error flushing the traces", "error", err)
+	}
+	log.Info("shutdown complete", "duration", time.Since(start))
+	_ = logging.Close()
 }
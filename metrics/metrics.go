@@ -0,0 +1,102 @@
+// Package metrics holds the Prometheus metrics of the service, they are exposed on /metrics by the server
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "converter"
+
+var (
+	// sizes from 1 KiB to 16 MiB
+	sizeBuckets = prometheus.ExponentialBuckets(1024, 4, 8)
+	// durations from 50 ms to about 7 minutes, the default timeout of the plugins is 5 minutes
+	pluginDurationBuckets = prometheus.ExponentialBuckets(0.05, 2, 14)
+)
+
+// Messages
+var (
+	MessagesConsumed = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_consumed_total",
+		Help:      "Messages received from the queues.",
+	}, []string{"queue"})
+	MessagesAcked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_acked_total",
+		Help:      "Messages acknowledged, once replied to or scheduled for a retry.",
+	}, []string{"queue"})
+	MessagesNacked = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_nacked_total",
+		Help:      "Messages negatively acknowledged, requeue tells whether they are delivered again.",
+	}, []string{"queue", "requeue"})
+)
+
+// Conversions
+var (
+	Conversions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "conversions_total",
+		Help:      "Plugin executions, by plugin, runtime and outcome (success or the error code).",
+	}, []string{"plugin_id", "runtime", "outcome"})
+	PluginDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "plugin_duration_seconds",
+		Help:      "Duration of the plugin executions.",
+		Buckets:   pluginDurationBuckets,
+	}, []string{"plugin_id", "runtime"})
+	PayloadSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "payload_size_bytes",
+		Help:      "Size of the payloads given to the plugins.",
+		Buckets:   sizeBuckets,
+	}, []string{"plugin_id"})
+	OutputSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "output_size_bytes",
+		Help:      "Size of the outputs written by the plugins that succeeded.",
+		Buckets:   sizeBuckets,
+	}, []string{"plugin_id"})
+	InflightExecutions = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "inflight_executions",
+		Help:      "Plugin executions in progress, test runs excluded.",
+	}, []string{"plugin_id"})
+	InflightTestRuns = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "inflight_test_runs",
+		Help:      "Test and fixture runs of plugins in progress.",
+	}, []string{"plugin_id"})
+)
+
+// Broker
+var BrokerReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+	Namespace: namespace,
+	Name:      "broker_reconnects_total",
+	Help:      "Attempts to reconnect to the broker, by result (success or failure).",
+}, []string{"result"})
+
+// Database
+var DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Namespace: namespace,
+	Name:      "db_query_duration_seconds",
+	Help:      "Duration of the database queries, by operation (select, insert, update, delete or other).",
+	Buckets:   prometheus.DefBuckets,
+}, []string{"operation"})
+
+// HTTP
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests, by method, route and status.",
+	}, []string{"method", "route", "status"})
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Duration of the HTTP requests, by method and route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route"})
+)
@@ -3,21 +3,31 @@ package rabbit
 import (
 	"context"
 	"fmt"
+	"math/rand/v2"
 	"os"
-	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"github.com/epos-eu/converter-service/handler"
+	"github.com/epos-eu/converter-service/internal/env"
 	"github.com/epos-eu/converter-service/logging"
+	"github.com/epos-eu/converter-service/metrics"
+	"github.com/epos-eu/converter-service/transport"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 var (
-	maxMessages          = 0
-	maxReconnectAttempts = 0
-	log                  = logging.Get("broker")
+	maxMessages       = 0
+	mapPrefetch       = 0
+	resourcesPrefetch = 0
+	// the backoff between two reconnection attempts doubles from a second up to reconnectMaxBackoff
+	reconnectMaxBackoff = time.Minute
+	// the service exits once it has been disconnected for exitAfterDisconnected, 0 disables it
+	exitAfterDisconnected time.Duration
+	log                   = logging.Get("broker")
 )
 
+// the default topology, see topologyFromEnv
 const (
 	// exchanges
 	ExchangeExternalAccess  = "externalAccess"
@@ -36,69 +46,108 @@ const (
 )
 
 func init() {
-	maxMessages = envInt("MAX_MESSAGES", 1)
-	maxReconnectAttempts = envInt("MAX_RECONNECT_ATTEMPTS", 10)
+	maxMessages = env.Int("MAX_MESSAGES", 1)
+	// the prefetch of each queue, MAX_MESSAGES is the default of both
+	mapPrefetch = env.Int("MAP_PREFETCH", maxMessages)
+	resourcesPrefetch = env.Int("RESOURCES_PREFETCH", maxMessages)
+	reconnectMaxBackoff = time.Duration(max(env.Int("RECONNECT_MAX_BACKOFF", int(reconnectMaxBackoff.Seconds())), 1)) * time.Second
+	exitAfterDisconnected = time.Duration(env.Int("EXIT_AFTER_DISCONNECTED", 0)) * time.Minute
 }
 
 type BrokerConfig struct {
-	host, user, password, vhost        string
-	Conn                               *amqp.Connection
-	publishChan, consumeChan           *amqp.Channel
-	externalAccessQ, resourcesServiceQ *amqp.Queue
+	connection connectionConfig
+	// the current connection, replaced by the monitor on reconnection while Shutdown may be closing it
+	conn atomic.Pointer[amqp.Connection]
+	// the publisher of the current connection
+	publisher atomic.Pointer[publisher]
+	// the consumer of each queue, they are started again with every new connection
+	consumers []*consumer
+
+	mu     sync.Mutex
+	status BrokerStatus
+
+	// closed by Shutdown to stop the consumers
+	stopping     chan struct{}
+	stoppingOnce sync.Once
+	// the running consumers
+	running sync.WaitGroup
+	// closed once monitor returned
+	monitorDone chan struct{}
 }
 
-func (b *BrokerConfig) dial() error {
-	log.Debug("attempting to connect to RabbitMQ", "host", b.host, "vhost", b.vhost, "user", b.user)
-	uri := fmt.Sprintf("amqp://%s:%s@%s/%s", b.user, b.password, b.host, b.vhost)
-	var err error
-	b.Conn, err = amqp.Dial(uri)
+var _ transport.Transport = (*BrokerConfig)(nil)
+
+func (b *BrokerConfig) dial() (*amqp.Connection, error) {
+	uri, config, err := b.connection.amqpConfig()
 	if err != nil {
-		log.Error("failed to connect to RabbitMQ", "error", err)
-		return fmt.Errorf("error during dial AMQP: %w", err)
+		log.Error("invalid RabbitMQ connection configuration", "error", err)
+		return nil, fmt.Errorf("error configuring the AMQP connection: %w", err)
 	}
-	log.Info("successfully connected to RabbitMQ", "host", b.host, "vhost", b.vhost)
-	return nil
+	redacted := redactURL(uri)
+	log.Debug("attempting to connect to RabbitMQ", "url", redacted, "tls", config.TLSClientConfig != nil)
+	conn, err := amqp.DialConfig(uri, config)
+	if err != nil {
+		log.Error("failed to connect to RabbitMQ", "url", redacted, "error", err)
+		return nil, fmt.Errorf("error during dial AMQP: %w", err)
+	}
+	b.conn.Store(conn)
+	log.Info("successfully connected to RabbitMQ", "url", redacted)
+	return conn, nil
 }
 
-func NewBroker() *BrokerConfig {
+// NewBroker returns the AMQP transport, the messages of each queue are handled by its handler in handlers
+func NewBroker(handlers transport.Handlers) *BrokerConfig {
 	log.Debug("initializing new broker with environment variables")
-	host := env("BROKER_HOST", "rabbitmq")
-	user := env("BROKER_USERNAME", "changeme")
-	password := env("BROKER_PASSWORD", "changeme")
-	vhost := env("BROKER_VHOST", "changeme")
-
-	log.Info("broker configuration created", "host", host, "user", user, "vhost", vhost)
-	return &BrokerConfig{
-		host:     host,
-		user:     user,
-		password: password,
-		vhost:    vhost,
+	connection := connectionConfigFromEnv()
+
+	log.Info("broker configuration created", "host", connection.host, "user", connection.user, "vhost", connection.vhost, "url_set", connection.url != "" || connection.urlFile != "")
+	b := &BrokerConfig{
+		connection:  connection,
+		stopping:    make(chan struct{}),
+		monitorDone: make(chan struct{}),
 	}
+	b.consumers = []*consumer{
+		{
+			broker:   b,
+			topology: topologyFromEnv("MAP_", ExchangeExternalAccess, QueueMap, BindingKeyMap, RkAccessReturn),
+			prefetch: mapPrefetch,
+			handle:   handlers[transport.QueueMap],
+		},
+		{
+			broker:   b,
+			topology: topologyFromEnv("RESOURCES_", ExchangeMetadataService, QueueResources, BindingKeyMap, RkMapReturn),
+			prefetch: resourcesPrefetch,
+			handle:   handlers[transport.QueueResources],
+		},
+	}
+	for _, c := range b.consumers {
+		c.status = ConsumerStatus{Queue: c.queue, State: ConsumerStopped, Since: time.Now()}
+	}
+	b.status = BrokerStatus{State: BrokerReconnecting, Since: time.Now()}
+	return b
+}
+
+// Consumers returns the status of the consumer of each queue
+func (b *BrokerConfig) Consumers() []ConsumerStatus {
+	statuses := make([]ConsumerStatus, 0, len(b.consumers))
+	for _, c := range b.consumers {
+		statuses = append(statuses, c.Status())
+	}
+	return statuses
 }
 
 func (b *BrokerConfig) Restart() error {
 	log.Info("restarting broker connection")
 
-	// close old stuff if open
-	if b.consumeChan != nil {
-		log.Debug("closing consumer channel")
-		err := b.consumeChan.Close()
-		if err != nil {
-			log.Warn("error closing consumer channel", "error", err)
-		}
-	}
-
-	if b.publishChan != nil {
-		log.Debug("closing publisher channel")
-		err := b.publishChan.Close()
-		if err != nil {
-			log.Warn("error closing publisher channel", "error", err)
-		}
+	// close old stuff if open, the channels of the consumers are closed with the connection
+	if p := b.publisher.Load(); p != nil {
+		log.Debug("closing publisher channels")
+		p.close()
 	}
 
-	if b.Conn != nil {
+	if conn := b.conn.Load(); conn != nil {
 		log.Debug("closing connection")
-		err := b.Conn.Close()
+		err := conn.Close()
 		if err != nil {
 			log.Warn("error closing connection", "error", err)
 		}
@@ -106,186 +155,242 @@ func (b *BrokerConfig) Restart() error {
 
 	log.Debug("cleared old connection/channels, starting new connection")
 
-	return b.Start()
+	return b.start()
 }
 
-// Start starts the broker connection to the server and starts the message listening/handling
-func (b *BrokerConfig) Start() error {
-	log.Info("starting broker connection")
-	err := b.dial()
-	if err != nil {
-		log.Error("failed to dial AMQP", "error", err)
-		return fmt.Errorf("error while dialing AMQP: %w", err)
+// Start starts the broker connection to the server and starts the message listening/handling. The connection is
+// monitored and restarted until ctx is done. When RabbitMQ can't be reached at startup, the broker connects in the
+// background with the same backoff as a reconnection, only an invalid connection configuration is returned.
+func (b *BrokerConfig) Start(ctx context.Context) error {
+	if _, _, err := b.connection.amqpConfig(); err != nil {
+		log.Error("invalid RabbitMQ connection configuration", "error", err)
+		return fmt.Errorf("error configuring the AMQP connection: %w", err)
 	}
-
-	// channels
-	log.Debug("creating publish channel")
-	b.publishChan, err = b.Conn.Channel()
+	err := b.start()
 	if err != nil {
-		log.Error("failed to create publish channel", "error", err)
-		return fmt.Errorf("error on opening the publish channel: %w", err)
+		log.Error("initial connection failed, connecting in the background", "error", err)
+		b.setState(BrokerReconnecting, 0, err)
 	}
+	go b.monitor(ctx, err == nil)
+	return nil
+}
 
-	log.Debug("creating consume channel")
-	b.consumeChan, err = b.Conn.Channel()
+func (b *BrokerConfig) start() error {
+	log.Info("starting broker connection")
+	conn, err := b.dial()
 	if err != nil {
-		log.Error("failed to create consume channel", "error", err)
-		return fmt.Errorf("error on opeing the consume channel: %w", err)
+		log.Error("failed to dial AMQP", "error", err)
+		return fmt.Errorf("error while dialing AMQP: %w", err)
 	}
 
-	// qos on consumer channel only
-	log.Debug("setting QoS parameters", "prefetch", maxMessages)
-	err = b.consumeChan.Qos(maxMessages, 0, false)
+	// channels
+	log.Debug("creating publish channels", "pool_size", publisherPoolSize)
+	p, err := newPublisher(conn, publisherPoolSize)
 	if err != nil {
-		log.Error("failed to set QoS", "error", err)
-		return fmt.Errorf("error setting the Qos: %w", err)
+		log.Error("failed to create publish channels", "error", err)
+		return fmt.Errorf("error on opening the publish channels: %w", err)
 	}
+	b.publisher.Store(p)
 
 	// topology
-	log.Info("initializing external access queue", "exchange", ExchangeExternalAccess, "queue", QueueMap)
-	b.externalAccessQ, err = b.initQueue(ExchangeExternalAccess, QueueMap, BindingKeyMap)
-	if err != nil {
-		log.Error("failed to initialize external access queue", "error", err)
-		return err
-	}
-
-	log.Info("initializing resources service queue", "exchange", ExchangeMetadataService, "queue", QueueResources)
-	b.resourcesServiceQ, err = b.initQueue(ExchangeMetadataService, QueueResources, BindingKeyMap)
-	if err != nil {
-		log.Error("failed to initialize resources service queue", "error", err)
-		return err
+	for _, c := range b.consumers {
+		log.Info("initializing queue", "exchange", c.exchange, "queue", c.queue)
+		if err := b.initQueue(conn, c.topology); err != nil {
+			log.Error("failed to initialize queue", "queue", c.queue, "error", err)
+			return err
+		}
 	}
 
-	// start consumers
+	// start consumers, each one on its own channel
 	log.Info("starting message handlers")
-	go b.handleMessages(
-		b.externalAccessQ,
-		ExchangeExternalAccess,
-		RkAccessReturn,
-		handler.ExternalAccessHandler,
-	)
-	go b.handleMessages(
-		b.resourcesServiceQ,
-		ExchangeMetadataService,
-		RkMapReturn,
-		handler.ResourcesServiceHandler,
-	)
+	for _, c := range b.consumers {
+		b.running.Add(1)
+		go func() {
+			defer b.running.Done()
+			c.supervise(conn)
+		}()
+	}
+	b.setState(BrokerConnected, 0, nil)
 	log.Info("broker successfully started")
 	return nil
 }
 
-func (b *BrokerConfig) initQueue(exchange, queue, bindingKey string) (*amqp.Queue, error) {
-	log.Debug("initializing queue", "exchange", exchange, "queue", queue, "bindingKey", bindingKey)
-	ch, err := b.Conn.Channel()
+func (b *BrokerConfig) initQueue(conn *amqp.Connection, t topology) error {
+	log.Debug("initializing queue", "exchange", t.exchange, "queue", t.queue, "binding_keys", t.bindingKeys)
+	ch, err := conn.Channel()
 	if err != nil {
 		log.Error("failed to create channel for queue initialization", "error", err)
-		return nil, err
-	}
-
-	log.Debug("declaring exchange", "name", exchange, "type", "topic")
-	err = ch.ExchangeDeclare(exchange, "topic", true, false, false, false, nil)
-	if err != nil {
-		log.Error("failed to declare exchange", "exchange", exchange, "error", err)
-		return nil, fmt.Errorf("error declaring exchange: %w", err)
+		return err
 	}
 
-	log.Debug("declaring queue", "name", queue)
-	q, err := ch.QueueDeclare(queue, true, false, false, false, nil)
+	log.Debug("declaring exchange", "name", t.exchange, "type", "topic", "durable", t.durable)
+	err = ch.ExchangeDeclare(t.exchange, "topic", t.durable, false, false, false, nil)
 	if err != nil {
-		log.Error("failed to declare queue", "queue", queue, "error", err)
-		return nil, fmt.Errorf("error declaring queue: %w", err)
+		log.Error("failed to declare exchange", "exchange", t.exchange, "error", err)
+		return fmt.Errorf("error declaring exchange: %w", err)
 	}
 
-	log.Debug("binding queue", "queue", queue, "bindingKey", bindingKey, "exchange", exchange)
-	err = ch.QueueBind(q.Name, bindingKey, exchange, false, nil)
+	args := t.queueArgs()
+	log.Debug("declaring queue", "name", t.queue, "durable", t.durable, "args", args)
+	q, err := ch.QueueDeclare(t.queue, t.durable, false, false, false, args)
 	if err != nil {
-		log.Error("failed to bind queue", "queue", queue, "bindingKey", bindingKey, "exchange", exchange, "error", err)
-		return nil, fmt.Errorf("error binding queue: %w", err)
+		log.Error("failed to declare queue", "queue", t.queue, "error", err)
+		return fmt.Errorf("error declaring queue: %w", err)
 	}
 
-	log.Debug("closing temporary channel used for queue initialization")
-	err = ch.Close()
-	if err != nil {
-		log.Warn("error closing temp channel when initializing queue (possible leak)", "queue", queue, "bindingKey", bindingKey, "exchange", exchange, "error", err)
-	}
-	log.Info("queue initialized successfully", "exchange", exchange, "queue", queue, "bindingKey", bindingKey)
-	return &q, nil
-}
-
-func env(k, def string) string {
-	if v, ok := os.LookupEnv(k); ok {
-		log.Debug("environment variable found", "name", k, "value", v)
-		return v
-	}
-	log.Info("env variable not found, using default", "name", k, "default", def)
-	return def
-}
-
-func envInt(key string, defaultVal int) int {
-	strVal := env(key, strconv.FormatInt(int64(defaultVal), 10))
-	if strVal == "" {
-		log.Debug("environment variable not set, using default", "name", key, "default", defaultVal)
-		return defaultVal
+	for _, bindingKey := range t.bindingKeys {
+		log.Debug("binding queue", "queue", t.queue, "bindingKey", bindingKey, "exchange", t.exchange)
+		err = ch.QueueBind(q.Name, bindingKey, t.exchange, false, nil)
+		if err != nil {
+			log.Error("failed to bind queue", "queue", t.queue, "bindingKey", bindingKey, "exchange", t.exchange, "error", err)
+			return fmt.Errorf("error binding queue: %w", err)
+		}
 	}
 
-	val, err := strconv.Atoi(strVal)
-	if err != nil {
-		log.Warn("invalid integer value, using default", "name", key, "value", strVal, "error", err, "default", defaultVal)
-		return defaultVal
+	log.Debug("declaring retry and dead queues", "queue", t.queue, "exchange", deadLetterExchange)
+	if err := initRetryQueues(ch, t); err != nil {
+		log.Error("failed to initialize retry queues", "queue", t.queue, "error", err)
+		return err
 	}
 
-	return val
-}
-
-func failOnError(err error, msg string) {
+	log.Debug("closing temporary channel used for queue initialization")
+	err = ch.Close()
 	if err != nil {
-		log.Error(msg, "error", err)
-		panic(fmt.Sprintf("%s: %v", msg, err))
+		log.Warn("error closing temp channel when initializing queue (possible leak)", "queue", t.queue, "exchange", t.exchange, "error", err)
 	}
+	log.Info("queue initialized successfully", "exchange", t.exchange, "queue", t.queue, "binding_keys", t.bindingKeys)
+	return nil
 }
 
-// Monitor start monitoring a broker config for connection closing. If it happens, it will create a new connection and start it.
-func (b *BrokerConfig) Monitor(ctx context.Context) {
+// monitor start monitoring a broker config for connection closing. If it happens, it reconnects until it succeeds,
+// with a backoff, and starts the broker again on the new connection. When the broker is not connected yet, it connects
+// first.
+func (b *BrokerConfig) monitor(ctx context.Context, connected bool) {
 	log.Info("starting connection monitor")
+	defer close(b.monitorDone)
+	if !connected && !b.reconnect(ctx) {
+		log.Info("monitor shutting down")
+		return
+	}
 	for {
 		// listen to the current connection
 		log.Debug("setting up connection close notification channel")
-		closeC := b.Conn.NotifyClose(make(chan *amqp.Error, 1))
+		closeC := b.conn.Load().NotifyClose(make(chan *amqp.Error, 1))
 
 		// wait for either a close event or a shutdown signal
 		log.Debug("waiting for close events or shutdown signal")
 		select {
 		case err, ok := <-closeC:
-			// conn closed intentionally (Conn.Close)
+			// conn closed intentionally (by Restart or Shutdown)
 			if !ok {
 				log.Info("connection closed intentionally, monitor shutting down")
 				return
 			}
 			log.Error("connection closed unexpectedly", "error", err)
+			b.setState(BrokerReconnecting, 0, err)
 
 			// reconnect reusing the same broker pointer
-			backoff := time.Second
-			log.Info("attempting to reconnect", "max_attempts", maxReconnectAttempts)
-			for attempt := 1; attempt <= maxReconnectAttempts; attempt++ {
-				log.Debug("reconnection attempt", "attempt", attempt, "backoff", backoff)
-				err := b.Restart()
-				if err != nil {
-					log.Error("reconnection failed", "attempt", attempt, "error", err)
-					// exponential back‑off
-					time.Sleep(backoff)
-					backoff *= 2
-					continue
-				}
-				log.Info("reconnection successful", "attempt", attempt)
-				break
+			if !b.reconnect(ctx) {
+				log.Info("monitor shutting down")
+				return
 			}
 
 		case <-ctx.Done():
-			// propagate graceful shutdown
-			log.Info("received shutdown signal, closing connection")
-			_ = b.Conn.Close()
-			log.Info("monitor shutting down")
+			// the connection is closed by Shutdown, once the consumers are drained
+			log.Info("received shutdown signal, monitor shutting down")
 			return
 		}
 	}
 }
+
+// reconnect restarts the broker until it succeeds or ctx is done, which is when it returns false. The backoff between
+// two attempts doubles up to reconnectMaxBackoff, and is jittered so that the replicas don't reconnect all at once.
+func (b *BrokerConfig) reconnect(ctx context.Context) bool {
+	disconnected := time.Now()
+	backoff := time.Second
+	log.Info("attempting to reconnect", "max_backoff", reconnectMaxBackoff, "exit_after", exitAfterDisconnected)
+	for attempt := 1; ; attempt++ {
+		log.Debug("reconnection attempt", "attempt", attempt)
+		err := b.Restart()
+		if err == nil {
+			metrics.BrokerReconnects.WithLabelValues("success").Inc()
+			log.Info("reconnection successful", "attempt", attempt, "disconnected_for", time.Since(disconnected))
+			return true
+		}
+		metrics.BrokerReconnects.WithLabelValues("failure").Inc()
+
+		state := BrokerReconnecting
+		if attempt >= reconnectFailureThreshold {
+			state = BrokerDegraded
+		}
+		b.setState(state, attempt, err)
+		if exitAfterDisconnected > 0 && time.Since(disconnected) >= exitAfterDisconnected {
+			log.Error("disconnected for too long, exiting", "disconnected_for", time.Since(disconnected), "attempts", attempt, "error", err)
+			os.Exit(1)
+		}
+
+		// wait a random time between half the backoff and the backoff
+		wait := backoff/2 + rand.N(backoff/2+1)
+		log.Error("reconnection failed", "attempt", attempt, "state", state, "retry_in", wait, "error", err)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return false
+		}
+		backoff = min(backoff*2, reconnectMaxBackoff)
+	}
+}
+
+// Shutdown stops the consumers, waits for the messages being handled to be replied to and acknowledged, then closes
+// the connection. The messages still being handled when ctx is done are redelivered by the broker. Shutdown waits for
+// the monitor of the connection to return first, the ctx given to Start must be done.
+func (b *BrokerConfig) Shutdown(ctx context.Context) error {
+	log.Info("shutting down broker")
+	b.stoppingOnce.Do(func() { close(b.stopping) })
+
+	var err error
+	select {
+	case <-b.monitorDone:
+	case <-ctx.Done():
+		err = fmt.Errorf("monitor still running: %w", ctx.Err())
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		b.running.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+		log.Info("consumers drained")
+	case <-ctx.Done():
+		log.Warn("consumers not drained before the deadline, their messages will be redelivered")
+		err = fmt.Errorf("consumers not drained: %w", ctx.Err())
+	}
+
+	if p := b.publisher.Load(); p != nil {
+		p.close()
+	}
+	// the monitor may still be running when ctx is done, it returns once the connection it watches is closed
+	if conn := b.conn.Load(); conn != nil && !conn.IsClosed() {
+		if closeErr := conn.Close(); closeErr != nil {
+			log.Warn("error closing connection", "error", closeErr)
+		}
+	}
+	log.Info("broker shut down")
+	return err
+}
+
+// Health returns an error when the broker keeps failing to reconnect, or a consumer keeps failing. They restart by
+// themselves, so they are healthy while they are restarting.
+func (b *BrokerConfig) Health() error {
+	if status := b.Status(); status.State == BrokerDegraded {
+		return fmt.Errorf("broker %s since %s (%d failed attempts): %s", status.State, status.Since.Format(time.RFC3339), status.Attempts, status.LastError)
+	}
+	for _, consumer := range b.Consumers() {
+		if consumer.State == ConsumerFailed {
+			return fmt.Errorf("consumer of queue %s failing since %s (%d restarts): %s", consumer.Queue, consumer.Since.Format(time.RFC3339), consumer.Restarts, consumer.LastError)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,27 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/epos-eu/converter-service/transport"
+)
+
+func TestShutdownBeforeMonitorStopped(t *testing.T) {
+	b := NewBroker(transport.Handlers{})
+	// the monitor never ran, as if it were still reconnecting
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	err := b.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v, want the deadline of the shutdown", err)
+	}
+	select {
+	case <-b.stopping:
+	default:
+		t.Error("the consumers were not told to stop")
+	}
+}
@@ -0,0 +1,168 @@
+package rabbit
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/epos-eu/converter-service/internal/env"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// connectionConfig is how the broker connects to RabbitMQ. The connection is either described by url, or by its parts.
+// The secrets are read from their file, when one is set, every time the broker connects, so that they can be rotated.
+type connectionConfig struct {
+	url, urlFile                string
+	host, user, userFile, vhost string
+	password, passwordFile      string
+	tls                         bool
+	// TLS settings
+	caFile, certFile, keyFile, serverName string
+}
+
+// ErrNoBrokerURL is returned when neither the URL of the broker nor its host is set
+var ErrNoBrokerURL = errors.New("no broker URL nor host")
+
+func connectionConfigFromEnv() connectionConfig {
+	return connectionConfig{
+		url:          env.Secret("BROKER_URL", ""),
+		urlFile:      env.Get("BROKER_URL_FILE", ""),
+		host:         env.Get("BROKER_HOST", "rabbitmq"),
+		user:         env.Get("BROKER_USERNAME", "changeme"),
+		userFile:     env.Get("BROKER_USERNAME_FILE", ""),
+		vhost:        env.Get("BROKER_VHOST", "changeme"),
+		password:     env.Secret("BROKER_PASSWORD", "changeme"),
+		passwordFile: env.Get("BROKER_PASSWORD_FILE", ""),
+		tls:          env.Get("BROKER_TLS", "false") == "true",
+		caFile:       env.Get("BROKER_TLS_CA_FILE", ""),
+		certFile:     env.Get("BROKER_TLS_CERT_FILE", ""),
+		keyFile:      env.Get("BROKER_TLS_KEY_FILE", ""),
+		serverName:   env.Get("BROKER_TLS_SERVER_NAME", ""),
+	}
+}
+
+// brokerURL returns the URL of the broker, BROKER_URL if it is set, or the URL built from its parts
+func (c connectionConfig) brokerURL() (*url.URL, error) {
+	raw, err := secret(c.url, c.urlFile)
+	if err != nil {
+		return nil, err
+	}
+	if raw != "" {
+		u, err := url.Parse(raw)
+		if err != nil {
+			// the error of url.Parse contains the URL, and its password
+			return nil, errors.New("invalid broker URL")
+		}
+		if u.Scheme != "amqp" && u.Scheme != "amqps" {
+			return nil, fmt.Errorf("invalid broker URL scheme %q, expected amqp or amqps", u.Scheme)
+		}
+		return u, nil
+	}
+
+	if c.host == "" {
+		return nil, ErrNoBrokerURL
+	}
+	user, err := secret(c.user, c.userFile)
+	if err != nil {
+		return nil, err
+	}
+	password, err := secret(c.password, c.passwordFile)
+	if err != nil {
+		return nil, err
+	}
+	scheme := "amqp"
+	if c.tls {
+		scheme = "amqps"
+	}
+	return &url.URL{
+		Scheme: scheme,
+		User:   url.UserPassword(user, password),
+		Host:   c.host,
+		// the vhost is a single path segment, a "/" in it has to be escaped
+		Path:    "/" + c.vhost,
+		RawPath: "/" + url.PathEscape(c.vhost),
+	}, nil
+}
+
+// tlsConfig returns the TLS configuration of the connection, nil when no TLS setting is set
+func (c connectionConfig) tlsConfig() (*tls.Config, error) {
+	if c.caFile == "" && c.certFile == "" && c.keyFile == "" && c.serverName == "" {
+		return nil, nil
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: c.serverName,
+	}
+	if c.caFile != "" {
+		ca, err := os.ReadFile(c.caFile)
+		if err != nil {
+			return nil, fmt.Errorf("error reading the CA bundle: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificate found in the CA bundle %s", c.caFile)
+		}
+	}
+	if c.certFile != "" || c.keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("error loading the client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// amqpConfig returns the URL and the configuration to dial the broker with
+func (c connectionConfig) amqpConfig() (string, amqp.Config, error) {
+	u, err := c.brokerURL()
+	if err != nil {
+		return "", amqp.Config{}, err
+	}
+	tlsConfig, err := c.tlsConfig()
+	if err != nil {
+		return "", amqp.Config{}, err
+	}
+	if tlsConfig != nil && u.Scheme != "amqps" {
+		log.Warn("TLS settings are ignored, the broker URL does not use amqps", "url", u.Redacted())
+	}
+
+	// the name of the connection identifies the replica in the RabbitMQ management UI
+	hostname, _ := os.Hostname()
+	properties := amqp.NewConnectionProperties()
+	properties.SetClientConnectionName(hostname)
+
+	return u.String(), amqp.Config{
+		// the defaults of amqp.Dial
+		Heartbeat:       10 * time.Second,
+		Locale:          "en_US",
+		TLSClientConfig: tlsConfig,
+		Properties:      properties,
+	}, nil
+}
+
+// redactURL returns the URL without its password, for logging
+func redactURL(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "invalid URL"
+	}
+	return u.Redacted()
+}
+
+// secret returns the content of file if it is set, without its trailing newline, and value otherwise
+func secret(value, file string) (string, error) {
+	if file == "" {
+		return value, nil
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("error reading secret file: %w", err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
@@ -1,25 +1,173 @@
 package rabbit
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/epos-eu/converter-service/metrics"
+	"github.com/epos-eu/converter-service/tracing"
+	"github.com/epos-eu/converter-service/transport"
 	amqp "github.com/rabbitmq/amqp091-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func (b *BrokerConfig) handleMessages(
-	queue *amqp.Queue,
-	exchangeName string,
-	routingKeySuffix string,
-	handler func([]byte) ([]byte, error),
-) {
+// ConsumerState is the state of the consumer of a queue
+type ConsumerState string
+
+const (
+	// the consumer is receiving the messages of its queue
+	ConsumerRunning ConsumerState = "running"
+	// the channel of the consumer was closed, or could not be opened, a new one will be opened after a backoff
+	ConsumerRestarting ConsumerState = "restarting"
+	// the consumer failed to restart consumerFailureThreshold times in a row, it keeps trying
+	ConsumerFailed ConsumerState = "failed"
+	// the connection of the consumer was closed, it will be started again with the new connection, or the broker was
+	// shut down
+	ConsumerStopped ConsumerState = "stopped"
+)
+
+const (
+	// the backoff between two restarts of a consumer doubles from consumerMinBackoff up to consumerMaxBackoff
+	consumerMinBackoff = time.Second
+	consumerMaxBackoff = 30 * time.Second
+	// the number of restarts failing in a row after which a consumer is failed
+	consumerFailureThreshold = 5
+)
+
+// ConsumerStatus reports the state of the consumer of a queue
+type ConsumerStatus struct {
+	Queue     string        `json:"queue"`
+	State     ConsumerState `json:"state"`
+	LastError string        `json:"last_error,omitempty"`
+	// the number of times the consumer was restarted
+	Restarts int `json:"restarts"`
+	// when the consumer entered its state
+	Since time.Time `json:"since"`
+}
+
+// consumer consumes a queue on its own channel with its own prefetch, so that the load or the failure of a queue never
+// stalls the others
+type consumer struct {
+	broker *BrokerConfig
+	topology
+	prefetch int
+	handle   transport.Handler
+
+	mu     sync.Mutex
+	status ConsumerStatus
+	// the deliveries being handled
+	inflight sync.WaitGroup
+}
+
+func (c *consumer) setState(state ConsumerState, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.status.Queue = c.queue
+	if state != c.status.State {
+		c.status.State = state
+		c.status.Since = time.Now()
+	}
+	if err != nil {
+		c.status.LastError = err.Error()
+	}
+	if state == ConsumerRestarting || state == ConsumerFailed {
+		c.status.Restarts++
+	}
+}
+
+// Status returns the current status of the consumer
+func (c *consumer) Status() ConsumerStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.status
+}
+
+// supervise consumes the queue on the connection, and opens a new channel with a backoff whenever the channel of the
+// consumer is closed or can't be opened. It returns once the connection is closed, or the broker is shut down.
+func (c *consumer) supervise(conn *amqp.Connection) {
+	connClose := conn.NotifyClose(make(chan *amqp.Error, 1))
+	backoff := consumerMinBackoff
+	failures := 0
+	for {
+		started, err := c.consume(conn, connClose)
+		if c.stopped() {
+			log.Info("consumer stopped", "queue", c.queue)
+			c.setState(ConsumerStopped, nil)
+			return
+		}
+		if conn.IsClosed() {
+			log.Info("connection closed, consumer stopped", "queue", c.queue)
+			c.setState(ConsumerStopped, err)
+			return
+		}
+		if started {
+			// the consumer was running, the failure is a new one
+			backoff = consumerMinBackoff
+			failures = 0
+		}
+		failures++
+		if failures >= consumerFailureThreshold {
+			log.Error("consumer keeps failing", "queue", c.queue, "error", err, "failures", failures, "backoff", backoff)
+			c.setState(ConsumerFailed, err)
+		} else {
+			log.Error("consumer stopped, restarting it", "queue", c.queue, "error", err, "backoff", backoff)
+			c.setState(ConsumerRestarting, err)
+		}
+
+		select {
+		case <-time.After(backoff):
+		case <-connClose:
+			log.Info("connection closed, consumer stopped", "queue", c.queue)
+			c.setState(ConsumerStopped, err)
+			return
+		case <-c.broker.stopping:
+			log.Info("consumer stopped", "queue", c.queue)
+			c.setState(ConsumerStopped, nil)
+			return
+		}
+		backoff = min(backoff*2, consumerMaxBackoff)
+	}
+}
+
+// stopped returns whether the broker is shutting down
+func (c *consumer) stopped() bool {
+	select {
+	case <-c.broker.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// consume opens a channel on the connection and handles the messages of the queue until the channel or the connection
+// is closed, or the broker is shutting down. started is whether the consumer was running before it stopped.
+func (c *consumer) consume(conn *amqp.Connection, connClose <-chan *amqp.Error) (started bool, err error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return false, fmt.Errorf("error opening the consume channel: %w", err)
+	}
+	defer func() { _ = ch.Close() }()
+	chanClose := ch.NotifyClose(make(chan *amqp.Error, 1))
+
+	log.Debug("setting QoS parameters", "queue", c.queue, "prefetch", c.prefetch)
+	if err := ch.Qos(c.prefetch, 0, false); err != nil {
+		return false, fmt.Errorf("error setting the Qos: %w", err)
+	}
+
 	hostname, _ := os.Hostname()
-	consumerTag := fmt.Sprintf("%s-%s-%d", queue.Name, hostname, time.Now().Unix())
+	consumerTag := fmt.Sprintf("%s-%s-%d", c.queue, hostname, time.Now().Unix())
 
-	msgs, err := b.consumeChan.Consume(
-		queue.Name,
+	msgs, err := ch.Consume(
+		c.queue,
 		consumerTag,
 		false,
 		false,
@@ -27,58 +175,127 @@ func (b *BrokerConfig) handleMessages(
 		false,
 		nil,
 	)
-	failOnError(err, "consume "+queue.Name)
+	if err != nil {
+		return false, fmt.Errorf("error consuming %s: %w", c.queue, err)
+	}
+	log.Info("consumer started", "queue", c.queue, "prefetch", c.prefetch)
+	c.setState(ConsumerRunning, nil)
 
-	// launch a new goroutine for each message received. We can assume we won't have more than maxMessages
+	// launch a new goroutine for each message received. We can assume we won't have more than prefetch
 	// goroutines at the same time because we set qos for the channel
-	for d := range msgs {
-		go func(delivery amqp.Delivery) {
-			log.Info("message received", "exchange", exchangeName, "queue", queue.Name)
-
-			resp, err := handler(delivery.Body)
-			if err != nil {
-				log.Error("handler failed", "error", err)
-				err = delivery.Nack(false, false) // don't re‑queue for retry
-				if err != nil {
-					log.Error("error nack-ing", "error", err)
-				}
-				return
+	for {
+		select {
+		case d, ok := <-msgs:
+			if !ok {
+				return true, errors.New("the deliveries channel was closed")
 			}
-
-			log.Debug("message handled successfully")
-
-			rk := buildRoutingKey(delivery.RoutingKey, routingKeySuffix)
-			err = b.publishChan.Publish(
-				exchangeName,
-				rk,
-				false,
-				false,
-				amqp.Publishing{
-					ContentType:   "application/json",
-					CorrelationId: delivery.CorrelationId,
-					Body:          resp,
-					Headers:       delivery.Headers,
-				},
-			)
-			if err != nil {
-				log.Error("publish failed", "error", err)
-				err = delivery.Nack(false, false) // don't re‑queue for retry
-				if err != nil {
-					log.Error("error nack-ing", "error", err)
-				}
-				return
+			metrics.MessagesConsumed.WithLabelValues(c.queue).Inc()
+			c.inflight.Add(1)
+			go func() {
+				defer c.inflight.Done()
+				log.Info("message received", "exchange", c.exchange, "queue", c.queue)
+				// continue the trace of the caller, from the traceparent header of the message
+				ctx := otel.GetTextMapPropagator().Extract(context.Background(), headerCarrier(d.Headers))
+				ctx, span := tracer.Start(ctx, c.queue+" process",
+					trace.WithSpanKind(trace.SpanKindConsumer),
+					trace.WithAttributes(
+						attribute.String("messaging.system", "rabbitmq"),
+						attribute.String("messaging.destination.name", c.queue),
+						attribute.String("messaging.rabbitmq.destination.routing_key", d.RoutingKey),
+						attribute.String("messaging.message.conversation_id", d.CorrelationId),
+					))
+				transport.Handle(ctx, &delivery{d: d, c: c}, c.handle)
+				span.End()
+			}()
+		case amqpErr, ok := <-chanClose:
+			if !ok || amqpErr == nil {
+				return true, errors.New("the consume channel was closed")
+			}
+			return true, fmt.Errorf("the consume channel was closed: %w", amqpErr)
+		case amqpErr := <-connClose:
+			if amqpErr == nil {
+				return true, errors.New("the connection was closed")
+			}
+			return true, fmt.Errorf("the connection was closed: %w", amqpErr)
+		case <-c.broker.stopping:
+			// stop receiving new deliveries, the ones received but not handled yet are redelivered
+			log.Info("cancelling consumer, waiting for the messages being handled", "queue", c.queue)
+			if err := ch.Cancel(consumerTag, false); err != nil {
+				log.Warn("error cancelling consumer", "queue", c.queue, "error", err)
 			}
+			// the deliveries are acknowledged on the channel, it stays open until they are all handled
+			c.inflight.Wait()
+			return true, nil
+		}
+	}
+}
 
-			log.Debug("message sent successfully")
+// delivery is the transport.Message of an AMQP delivery
+type delivery struct {
+	d amqp.Delivery
+	c *consumer
+}
 
-			if err = delivery.Ack(false); err != nil {
-				log.Error("ack failed", "error", err)
-				return
-			}
+func (d *delivery) Body() []byte {
+	return d.d.Body
+}
 
-			log.Debug("message acknowledged successfully")
-		}(d)
+func (d *delivery) CorrelationID() string {
+	return d.d.CorrelationId
+}
+
+// Reply publishes the reply on the exchange of the queue, with the routing key of the message and the reply suffix. It
+// returns once the broker confirmed the reply, so that the delivery is only acknowledged then.
+func (d *delivery) Reply(ctx context.Context, body []byte) error {
+	rk := buildRoutingKey(originalRoutingKey(d.d), d.c.replySuffix)
+	ctx, span := tracer.Start(ctx, d.c.exchange+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "rabbitmq"),
+			attribute.String("messaging.destination.name", d.c.exchange),
+			attribute.String("messaging.rabbitmq.destination.routing_key", rk),
+		))
+
+	// the reply carries the trace context of the conversion in place of the one of the message
+	headers := maps.Clone(replyHeaders(d.d.Headers))
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+	otel.GetTextMapPropagator().Inject(ctx, headerCarrier(headers))
+
+	err := d.c.broker.publisher.Load().Publish(
+		ctx,
+		d.c.exchange,
+		rk,
+		amqp.Publishing{
+			ContentType:   "application/json",
+			CorrelationId: d.d.CorrelationId,
+			Body:          body,
+			Headers:       headers,
+		},
+	)
+	tracing.End(span, err)
+	return err
+}
+
+func (d *delivery) Ack() error {
+	if err := d.d.Ack(false); err != nil {
+		return err
+	}
+	metrics.MessagesAcked.WithLabelValues(d.c.queue).Inc()
+	return nil
+}
+
+func (d *delivery) Nack(requeue bool) error {
+	if err := d.d.Nack(false, requeue); err != nil {
+		return err
 	}
+	metrics.MessagesNacked.WithLabelValues(d.c.queue, strconv.FormatBool(requeue)).Inc()
+	return nil
+}
+
+func (d *delivery) Retry(class string, cause error) transport.RetryOutcome {
+	return d.c.broker.retry(d.d, d.c.queue, class, cause)
 }
 
 func buildRoutingKey(in, suffix string) string {
@@ -0,0 +1,161 @@
+package rabbit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/epos-eu/converter-service/internal/env"
+	"github.com/epos-eu/converter-service/transport"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var (
+	publisherPoolSize     = 4
+	publishConfirmTimeout = 10 * time.Second
+
+	// ErrPublishNacked is returned when the broker refuses a message
+	ErrPublishNacked = errors.New("the broker did not accept the message")
+	// ErrPublishReturned is returned when a message can't be routed to any queue, publishing it again would fail the
+	// same way
+	ErrPublishReturned = transport.ErrUnroutable
+)
+
+// the returns buffered per channel. They are read by the publish that caused them, or dropped by the next publish on
+// the channel if it timed out, but the connection stalls if the buffer is full.
+const returnsBuffer = 64
+
+func init() {
+	publisherPoolSize = max(env.Int("PUBLISHER_POOL_SIZE", publisherPoolSize), 1)
+	publishConfirmTimeout = time.Duration(env.Int("PUBLISH_CONFIRM_TIMEOUT", int(publishConfirmTimeout.Seconds()))) * time.Second
+}
+
+// publisher publishes messages on a pool of channels in confirm mode. A channel is used by one publish at a time, so
+// that the messages returned by the broker can be told apart.
+type publisher struct {
+	conn     *amqp.Connection
+	channels chan *publishChannel
+}
+
+type publishChannel struct {
+	ch      *amqp.Channel
+	returns chan amqp.Return
+}
+
+// newPublisher opens the channels of the pool on the connection
+func newPublisher(conn *amqp.Connection, size int) (*publisher, error) {
+	p := &publisher{
+		conn:     conn,
+		channels: make(chan *publishChannel, size),
+	}
+	for range size {
+		pc := &publishChannel{}
+		if err := p.open(pc); err != nil {
+			p.close()
+			return nil, err
+		}
+		p.channels <- pc
+	}
+	return p, nil
+}
+
+// open opens a new channel in confirm mode for pc
+func (p *publisher) open(pc *publishChannel) error {
+	ch, err := p.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("error opening a publish channel: %w", err)
+	}
+	if err := ch.Confirm(false); err != nil {
+		_ = ch.Close()
+		return fmt.Errorf("error putting the publish channel in confirm mode: %w", err)
+	}
+	pc.ch = ch
+	// the returns of a channel are only read while publishing, the buffer also keeps the late returns of the publishes
+	// that timed out
+	pc.returns = ch.NotifyReturn(make(chan amqp.Return, returnsBuffer))
+	return nil
+}
+
+// Publish publishes the message as mandatory and waits for the broker to confirm it, for at most
+// publishConfirmTimeout. It fails if the broker refuses the message or can't route it.
+func (p *publisher) Publish(ctx context.Context, exchange, key string, msg amqp.Publishing) error {
+	ctx, cancel := context.WithTimeout(ctx, publishConfirmTimeout)
+	defer cancel()
+
+	var pc *publishChannel
+	select {
+	case pc = <-p.channels:
+	case <-ctx.Done():
+		return fmt.Errorf("no publish channel available: %w", ctx.Err())
+	}
+	defer func() { p.channels <- pc }()
+
+	if pc.ch == nil || pc.ch.IsClosed() {
+		if err := p.open(pc); err != nil {
+			pc.ch = nil
+			return err
+		}
+	}
+	// drop what the earlier publishes may have left
+	pc.dropReturns()
+
+	confirmation, err := pc.ch.PublishWithDeferredConfirmWithContext(ctx, exchange, key, true, false, msg)
+	if err != nil {
+		return fmt.Errorf("error publishing: %w", err)
+	}
+	acked, err := confirmation.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("error waiting for the confirmation of the broker: %w", err)
+	}
+	if !acked {
+		return ErrPublishNacked
+	}
+
+	// the broker sends the return of an unroutable message before confirming it, the late returns of the earlier
+	// publishes may come first
+	for {
+		select {
+		case r, ok := <-pc.returns:
+			if !ok {
+				return nil
+			}
+			if r.Exchange != exchange || r.RoutingKey != key || r.CorrelationId != msg.CorrelationId || r.MessageId != msg.MessageId {
+				log.Debug("dropping the return of an earlier message", "exchange", r.Exchange, "routing_key", r.RoutingKey, "correlation_id", r.CorrelationId)
+				continue
+			}
+			log.Warn("message returned by the broker", "exchange", r.Exchange, "routing_key", r.RoutingKey, "reply_code", r.ReplyCode, "reply_text", r.ReplyText, "correlation_id", r.CorrelationId)
+			return fmt.Errorf("%w: exchange %s, routing key %s: %s", ErrPublishReturned, r.Exchange, r.RoutingKey, r.ReplyText)
+		default:
+			return nil
+		}
+	}
+}
+
+// dropReturns empties the returns of the channel
+func (pc *publishChannel) dropReturns() {
+	for {
+		select {
+		case _, ok := <-pc.returns:
+			if !ok {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// close closes the channels of the pool that are not in use
+func (p *publisher) close() {
+	for {
+		select {
+		case pc := <-p.channels:
+			if pc.ch != nil {
+				_ = pc.ch.Close()
+			}
+		default:
+			return
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package rabbit
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/epos-eu/converter-service/internal/env"
+	"github.com/epos-eu/converter-service/metrics"
+	"github.com/epos-eu/converter-service/transport"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Failed messages whose error class is retryable are published to the dead-letter exchange, in the retry queue of their
+// queue. They wait there retryDelay, then go back to their queue through the default exchange. Once a message has been
+// retried maxRetries times, it is parked in the dead queue of its queue, where operators can inspect it.
+
+const (
+	// the default dead-letter exchange
+	ExchangeDeadLetter = "converter.dlx"
+
+	// suffixes of the queues declared for each queue
+	QueueRetrySuffix = ".retry"
+	QueueDeadSuffix  = ".dead"
+
+	// headers of the retried and parked messages
+	HeaderRetryCount         = "x-retry-count"
+	HeaderOriginalRoutingKey = "x-original-routing-key"
+	HeaderErrorCode          = "x-error-code"
+	HeaderErrorMessage       = "x-error-message"
+
+	// the error messages are truncated to keep the headers small
+	maxErrorMessageLength = 1024
+)
+
+var (
+	deadLetterExchange = ExchangeDeadLetter
+	maxRetries         = 3
+	retryDelay         = 10 * time.Second
+	// the error classes for which a message is retried, the others are terminal
+	retryableErrors = map[string]bool{}
+)
+
+func init() {
+	deadLetterExchange = env.Get("DEAD_LETTER_EXCHANGE", deadLetterExchange)
+	maxRetries = env.Int("MAX_RETRIES", maxRetries)
+	retryDelay = time.Duration(env.Int("RETRY_DELAY", int(retryDelay.Seconds()))) * time.Second
+	for _, class := range strings.Split(env.Get("RETRYABLE_ERRORS", "internal_error,"+transport.ErrorPublishFailed), ",") {
+		if class = strings.TrimSpace(class); class != "" {
+			retryableErrors[class] = true
+		}
+	}
+}
+
+// initRetryQueues declares the dead-letter exchange, and the retry and dead queues of the queue. The exchange is shared
+// by the queues, it is always durable so that its declaration doesn't depend on the durability of the queue.
+func initRetryQueues(ch *amqp.Channel, t topology) error {
+	queue := t.queue
+	err := ch.ExchangeDeclare(deadLetterExchange, "direct", true, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("error declaring dead-letter exchange: %w", err)
+	}
+
+	// expired messages are dead-lettered back to their queue through the default exchange
+	retryQueue, err := ch.QueueDeclare(queue+QueueRetrySuffix, t.durable, false, false, false, amqp.Table{
+		"x-dead-letter-exchange":    "",
+		"x-dead-letter-routing-key": queue,
+	})
+	if err != nil {
+		return fmt.Errorf("error declaring retry queue: %w", err)
+	}
+	if err := ch.QueueBind(retryQueue.Name, retryQueue.Name, deadLetterExchange, false, nil); err != nil {
+		return fmt.Errorf("error binding retry queue: %w", err)
+	}
+
+	deadQueue, err := ch.QueueDeclare(queue+QueueDeadSuffix, t.durable, false, false, false, nil)
+	if err != nil {
+		return fmt.Errorf("error declaring dead queue: %w", err)
+	}
+	if err := ch.QueueBind(deadQueue.Name, deadQueue.Name, deadLetterExchange, false, nil); err != nil {
+		return fmt.Errorf("error binding dead queue: %w", err)
+	}
+	return nil
+}
+
+// retry schedules a new attempt of the delivery, that failed with an error of the class, if the class is retryable.
+// Messages that are out of retries are parked in the dead queue of the queue.
+func (b *BrokerConfig) retry(delivery amqp.Delivery, queue, class string, cause error) transport.RetryOutcome {
+	if !retryableErrors[class] {
+		return transport.Terminal
+	}
+
+	count := retryCount(delivery.Headers)
+	key, parked := retryRoutingKey(queue, count)
+	publishing := amqp.Publishing{
+		Headers:       retryHeaders(delivery, class, cause, parked),
+		ContentType:   delivery.ContentType,
+		DeliveryMode:  amqp.Persistent,
+		CorrelationId: delivery.CorrelationId,
+		ReplyTo:       delivery.ReplyTo,
+		MessageId:     delivery.MessageId,
+		Body:          delivery.Body,
+	}
+
+	if parked {
+		err := b.publisher.Load().Publish(context.Background(), deadLetterExchange, key, publishing)
+		if err != nil {
+			log.Error("error parking message in the dead queue, requeueing it", "queue", queue, "correlation_id", delivery.CorrelationId, "retry_in", retryDelay, "error", err)
+			b.requeueAfterDelay(delivery, queue)
+			return transport.RetryScheduled
+		}
+		log.Warn("message out of retries, parked in the dead queue", "queue", queue, "correlation_id", delivery.CorrelationId, "retries", count, "error_code", class)
+		return transport.Parked
+	}
+
+	publishing.Expiration = strconv.FormatInt(retryDelay.Milliseconds(), 10)
+	err := b.publisher.Load().Publish(context.Background(), deadLetterExchange, key, publishing)
+	if err != nil {
+		log.Error("error scheduling the retry of the message, requeueing it", "queue", queue, "correlation_id", delivery.CorrelationId, "retry_in", retryDelay, "error", err)
+		b.requeueAfterDelay(delivery, queue)
+		return transport.RetryScheduled
+	}
+	log.Warn("message failed, retry scheduled", "queue", queue, "correlation_id", delivery.CorrelationId, "retry", count+1, "max_retries", maxRetries, "delay", retryDelay, "error_code", class)
+
+	if err := delivery.Ack(false); err != nil {
+		log.Error("ack failed", "error", err)
+		return transport.RetryScheduled
+	}
+	metrics.MessagesAcked.WithLabelValues(queue).Inc()
+	return transport.RetryScheduled
+}
+
+// requeueAfterDelay gives the delivery back to its queue once retryDelay has passed, or right away on shutdown, so that
+// a message that can't be retried nor parked is neither lost nor looping through the broker. The delivery keeps its
+// prefetch slot meanwhile.
+func (b *BrokerConfig) requeueAfterDelay(delivery amqp.Delivery, queue string) {
+	select {
+	case <-time.After(retryDelay):
+	case <-b.stopping:
+	}
+	if err := delivery.Nack(false, true); err != nil {
+		log.Error("error nack-ing", "error", err)
+		return
+	}
+	metrics.MessagesNacked.WithLabelValues(queue, "true").Inc()
+}
+
+// retryRoutingKey returns the routing key, on the dead-letter exchange, of a message of the queue that failed after
+// being retried count times: the one of the retry queue of the queue, or the one of its dead queue once the message is
+// out of retries
+func retryRoutingKey(queue string, count int) (key string, parked bool) {
+	if count >= maxRetries {
+		return queue + QueueDeadSuffix, true
+	}
+	return queue + QueueRetrySuffix, false
+}
+
+// retryHeaders returns the headers of the new attempt of the delivery that failed with an error of the class, or of the
+// message parked in the dead queue
+func retryHeaders(delivery amqp.Delivery, class string, cause error, parked bool) amqp.Table {
+	headers := maps.Clone(delivery.Headers)
+	if headers == nil {
+		headers = amqp.Table{}
+	}
+	if _, ok := headers[HeaderOriginalRoutingKey]; !ok {
+		headers[HeaderOriginalRoutingKey] = delivery.RoutingKey
+	}
+	headers[HeaderErrorCode] = class
+	headers[HeaderErrorMessage] = truncate(cause.Error(), maxErrorMessageLength)
+	if !parked {
+		headers[HeaderRetryCount] = int32(retryCount(delivery.Headers) + 1)
+	}
+	return headers
+}
+
+// retryCount returns the number of times the message has already been retried
+func retryCount(headers amqp.Table) int {
+	switch count := headers[HeaderRetryCount].(type) {
+	case int32:
+		return int(count)
+	case int64:
+		return int(count)
+	case int:
+		return count
+	case int16:
+		return int(count)
+	case int8:
+		return int(count)
+	default:
+		return 0
+	}
+}
+
+// originalRoutingKey returns the routing key the message was first published with, retried messages come back with the
+// name of their queue as routing key
+func originalRoutingKey(delivery amqp.Delivery) string {
+	if rk, ok := delivery.Headers[HeaderOriginalRoutingKey].(string); ok && rk != "" {
+		return rk
+	}
+	return delivery.RoutingKey
+}
+
+// replyHeaders returns the headers of the reply to a message, without the error of its previous attempt
+func replyHeaders(headers amqp.Table) amqp.Table {
+	if _, ok := headers[HeaderErrorCode]; !ok {
+		return headers
+	}
+	headers = maps.Clone(headers)
+	delete(headers, HeaderErrorCode)
+	delete(headers, HeaderErrorMessage)
+	return headers
+}
+
+func truncate(s string, length int) string {
+	if len(s) <= length {
+		return s
+	}
+	return s[:length]
+}
@@ -0,0 +1,137 @@
+package rabbit
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// xDeath is the header RabbitMQ adds to the messages dead-lettered from the retry queue
+var xDeath = []any{amqp.Table{"queue": "map.retry", "reason": "expired", "count": int64(2), "exchange": ExchangeDeadLetter}}
+
+func TestRetryCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers amqp.Table
+		want    int
+	}{
+		{name: "no headers", headers: nil, want: 0},
+		{name: "first attempt", headers: amqp.Table{"x-custom": "value"}, want: 0},
+		{name: "int32", headers: amqp.Table{HeaderRetryCount: int32(2)}, want: 2},
+		{name: "int64", headers: amqp.Table{HeaderRetryCount: int64(3)}, want: 3},
+		{name: "int", headers: amqp.Table{HeaderRetryCount: 1}, want: 1},
+		{name: "int16", headers: amqp.Table{HeaderRetryCount: int16(2)}, want: 2},
+		{name: "int8", headers: amqp.Table{HeaderRetryCount: int8(1)}, want: 1},
+		{name: "malformed string", headers: amqp.Table{HeaderRetryCount: "2"}, want: 0},
+		{name: "malformed float", headers: amqp.Table{HeaderRetryCount: 2.0}, want: 0},
+		// the count is the one of the service, the deaths counted by RabbitMQ are not used
+		{name: "x-death without count", headers: amqp.Table{"x-death": xDeath}, want: 0},
+		{name: "x-death with count", headers: amqp.Table{"x-death": xDeath, HeaderRetryCount: int32(1)}, want: 1},
+		{name: "malformed x-death", headers: amqp.Table{"x-death": "expired", HeaderRetryCount: int32(1)}, want: 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := retryCount(test.headers); got != test.want {
+				t.Errorf("got %d, want %d", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetryRoutingKey(t *testing.T) {
+	previous := maxRetries
+	maxRetries = 3
+	t.Cleanup(func() { maxRetries = previous })
+
+	tests := []struct {
+		count      int
+		wantKey    string
+		wantParked bool
+	}{
+		{count: 0, wantKey: "map.retry"},
+		{count: 2, wantKey: "map.retry"},
+		{count: 3, wantKey: "map.dead", wantParked: true},
+		{count: 7, wantKey: "map.dead", wantParked: true},
+	}
+	for _, test := range tests {
+		key, parked := retryRoutingKey("map", test.count)
+		if key != test.wantKey || parked != test.wantParked {
+			t.Errorf("after %d retries: got %s (parked: %t), want %s (parked: %t)", test.count, key, parked, test.wantKey, test.wantParked)
+		}
+	}
+
+	maxRetries = 0
+	if key, parked := retryRoutingKey("map", 0); key != "map.dead" || !parked {
+		t.Errorf("without retries: got %s (parked: %t), want map.dead", key, parked)
+	}
+}
+
+func TestRetryHeaders(t *testing.T) {
+	cause := errors.New("plugin failed")
+
+	// first failure, the message comes from the exchange it was published on
+	first := amqp.Delivery{RoutingKey: "map", Headers: amqp.Table{"traceparent": "00-abc-def-01"}}
+	headers := retryHeaders(first, "internal_error", cause, false)
+	if headers[HeaderOriginalRoutingKey] != "map" || headers[HeaderRetryCount] != int32(1) {
+		t.Errorf("got %v, want the original routing key map and a retry count of 1", headers)
+	}
+	if headers[HeaderErrorCode] != "internal_error" || headers[HeaderErrorMessage] != "plugin failed" || headers["traceparent"] != "00-abc-def-01" {
+		t.Errorf("got %v, want the error and the headers of the message", headers)
+	}
+	if _, ok := first.Headers[HeaderRetryCount]; ok {
+		t.Error("the headers of the delivery were modified")
+	}
+
+	// retried message, coming back from the retry queue through the default exchange
+	retried := amqp.Delivery{RoutingKey: "map", Headers: amqp.Table{
+		HeaderOriginalRoutingKey: "map.custom",
+		HeaderRetryCount:         int32(1),
+		"x-death":                xDeath,
+	}}
+	headers = retryHeaders(retried, "internal_error", cause, false)
+	if headers[HeaderOriginalRoutingKey] != "map.custom" || headers[HeaderRetryCount] != int32(2) {
+		t.Errorf("got %v, want the original routing key map.custom and a retry count of 2", headers)
+	}
+
+	// parked message, keeping the number of retries it went through
+	headers = retryHeaders(retried, "internal_error", errors.New(strings.Repeat("x", 2*maxErrorMessageLength)), true)
+	if headers[HeaderRetryCount] != int32(1) {
+		t.Errorf("got a retry count of %v, want 1", headers[HeaderRetryCount])
+	}
+	if message := headers[HeaderErrorMessage].(string); len(message) != maxErrorMessageLength {
+		t.Errorf("got an error message of %d bytes, want %d", len(message), maxErrorMessageLength)
+	}
+}
+
+func TestOriginalRoutingKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		delivery amqp.Delivery
+		want     string
+	}{
+		{name: "first attempt", delivery: amqp.Delivery{RoutingKey: "map"}, want: "map"},
+		{name: "retried", delivery: amqp.Delivery{RoutingKey: "map", Headers: amqp.Table{HeaderOriginalRoutingKey: "map.custom"}}, want: "map.custom"},
+		{name: "empty header", delivery: amqp.Delivery{RoutingKey: "map", Headers: amqp.Table{HeaderOriginalRoutingKey: ""}}, want: "map"},
+		{name: "malformed header", delivery: amqp.Delivery{RoutingKey: "map", Headers: amqp.Table{HeaderOriginalRoutingKey: int32(1)}}, want: "map"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := originalRoutingKey(test.delivery); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestReplyHeaders(t *testing.T) {
+	headers := amqp.Table{"traceparent": "00-abc-def-01", HeaderErrorCode: "internal_error", HeaderErrorMessage: "plugin failed"}
+	reply := replyHeaders(headers)
+	if _, ok := reply[HeaderErrorCode]; ok {
+		t.Errorf("got %v, want the headers without the error of the previous attempt", reply)
+	}
+	if reply["traceparent"] != "00-abc-def-01" || headers[HeaderErrorCode] != "internal_error" {
+		t.Errorf("got %v from %v, want the other headers kept and the headers of the message untouched", reply, headers)
+	}
+}
@@ -0,0 +1,50 @@
+package rabbit
+
+import "time"
+
+// BrokerState is the state of the connection of the broker
+type BrokerState string
+
+const (
+	// the broker is connected and its consumers are started
+	BrokerConnected BrokerState = "connected"
+	// the connection was lost, or is not open yet, the broker is reconnecting
+	BrokerReconnecting BrokerState = "reconnecting"
+	// the reconnection failed reconnectFailureThreshold times in a row, the broker keeps trying
+	BrokerDegraded BrokerState = "degraded"
+)
+
+// the number of reconnection attempts failing in a row after which the broker is degraded
+const reconnectFailureThreshold = 5
+
+// BrokerStatus reports the state of the connection of the broker
+type BrokerStatus struct {
+	State     BrokerState `json:"state"`
+	LastError string      `json:"last_error,omitempty"`
+	// the number of reconnection attempts that failed since the connection was lost
+	Attempts int `json:"attempts"`
+	// when the broker entered its state
+	Since time.Time `json:"since"`
+}
+
+func (b *BrokerConfig) setState(state BrokerState, attempts int, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if state != b.status.State {
+		b.status.State = state
+		b.status.Since = time.Now()
+	}
+	b.status.Attempts = attempts
+	if err != nil {
+		b.status.LastError = err.Error()
+	} else if state == BrokerConnected {
+		b.status.LastError = ""
+	}
+}
+
+// Status returns the current status of the connection of the broker
+func (b *BrokerConfig) Status() BrokerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.status
+}
@@ -0,0 +1,69 @@
+package rabbit
+
+import (
+	"strings"
+	"time"
+
+	"github.com/epos-eu/converter-service/internal/env"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// topology is where a queue is consumed from and where its replies are published. It is configured with environment
+// variables prefixed with the name of the queue (MAP_ or RESOURCES_), the queue arguments default to the unprefixed
+// variables shared by both queues.
+type topology struct {
+	// the exchange the queue is bound to, the replies are published on it
+	exchange string
+	queue    string
+	// the binding keys of the queue on the exchange
+	bindingKeys []string
+	// the suffix of the routing key of the replies
+	replySuffix string
+	// whether the exchange and the queues survive a broker restart
+	durable bool
+	// x-queue-type of the queue (classic, quorum...), the broker default if empty
+	queueType string
+	// x-message-ttl of the queue, 0 for no TTL
+	messageTTL time.Duration
+	// x-max-length of the queue, 0 for no limit
+	maxLength int
+}
+
+func topologyFromEnv(prefix, exchange, queue, bindingKeys, replySuffix string) topology {
+	return topology{
+		exchange:    env.Get(prefix+"EXCHANGE", exchange),
+		queue:       env.Get(prefix+"QUEUE", queue),
+		bindingKeys: splitList(env.Get(prefix+"BINDING_KEYS", bindingKeys)),
+		replySuffix: env.Get(prefix+"REPLY_SUFFIX", replySuffix),
+		durable:     env.Get(prefix+"DURABLE", env.Get("QUEUE_DURABLE", "true")) == "true",
+		queueType:   env.Get(prefix+"QUEUE_TYPE", env.Get("QUEUE_TYPE", "")),
+		messageTTL:  time.Duration(env.Int(prefix+"MESSAGE_TTL", env.Int("QUEUE_MESSAGE_TTL", 0))) * time.Second,
+		maxLength:   env.Int(prefix+"MAX_LENGTH", env.Int("QUEUE_MAX_LENGTH", 0)),
+	}
+}
+
+// queueArgs returns the arguments the queue is declared with. Changing them for an existing queue makes its
+// declaration fail, the queue has to be deleted first.
+func (t topology) queueArgs() amqp.Table {
+	args := amqp.Table{}
+	if t.queueType != "" {
+		args[amqp.QueueTypeArg] = t.queueType
+	}
+	if t.messageTTL > 0 {
+		args[amqp.QueueMessageTTLArg] = t.messageTTL.Milliseconds()
+	}
+	if t.maxLength > 0 {
+		args[amqp.QueueMaxLenArg] = int64(t.maxLength)
+	}
+	return args
+}
+
+func splitList(s string) []string {
+	var values []string
+	for v := range strings.SplitSeq(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
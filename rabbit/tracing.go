@@ -0,0 +1,33 @@
+package rabbit
+
+import (
+	"maps"
+	"slices"
+
+	"github.com/epos-eu/converter-service/tracing"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+var tracer = tracing.Tracer("rabbit")
+
+// headerCarrier carries the trace context in the headers of an AMQP message
+type headerCarrier amqp.Table
+
+func (c headerCarrier) Get(key string) string {
+	switch value := c[key].(type) {
+	case string:
+		return value
+	case []byte:
+		return string(value)
+	default:
+		return ""
+	}
+}
+
+func (c headerCarrier) Set(key, value string) {
+	c[key] = value
+}
+
+func (c headerCarrier) Keys() []string {
+	return slices.Collect(maps.Keys(c))
+}
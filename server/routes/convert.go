@@ -0,0 +1,121 @@
+package routes
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/epos-eu/converter-service/handler"
+	"github.com/epos-eu/converter-service/internal/env"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// the conversions run through the HTTP endpoint at the same time, apart from the ones of the queues
+var convertSlots chan struct{}
+
+func init() {
+	convertSlots = make(chan struct{}, max(env.Int("HTTP_CONVERT_CONCURRENCY", 2), 1))
+}
+
+// Convert converts a payload with the same plugin execution path as the messages of the map queue
+//
+//	@Summary		Convert a payload
+//	@Description	Convert a payload with a plugin or a pipeline. The body is either a message, as published on the map queue, or the raw payload when the distributionId query parameter is set, with its Content-Type as the request content type. Without a pluginId nor a pipelineId, the plugin is selected from the relations of the distribution.
+//	@Tags			Converter Service
+//	@Accept			json
+//	@Produce		json
+//	@Param			message				body		handler.Message	false	"Message, or raw payload"
+//	@Param			distributionId		query		string			false	"Distribution ID, for a raw payload"
+//	@Param			pluginId			query		string			false	"Plugin ID, for a raw payload"
+//	@Param			pipelineId			query		string			false	"Pipeline ID, for a raw payload"
+//	@Param			responseContentType	query		string			false	"Response content type, for a raw payload"
+//	@Param			X-Correlation-ID	header		string			false	"Correlation ID of the conversion in the logs"
+//	@Success		200					{object}	handler.Response
+//	@Failure		400					{object}	handler.ErrorReply
+//	@Failure		404					{object}	handler.ErrorReply
+//	@Failure		409					{object}	handler.ErrorReply
+//	@Failure		422					{object}	handler.ErrorReply
+//	@Failure		500					{object}	handler.ErrorReply
+//	@Failure		502					{object}	handler.ErrorReply
+//	@Failure		504					{object}	handler.ErrorReply
+//	@Router			/convert [post]
+func Convert(c *gin.Context) {
+	body, err := conversionMessage(c)
+	if err != nil {
+		log.Warn("Failed to read the conversion request", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read the request body"})
+		return
+	}
+
+	correlationID := c.GetHeader("X-Correlation-ID")
+	if correlationID == "" {
+		correlationID = uuid.NewString()
+	}
+	c.Header("X-Correlation-ID", correlationID)
+
+	select {
+	case convertSlots <- struct{}{}:
+		defer func() { <-convertSlots }()
+	case <-c.Request.Context().Done():
+		log.Warn("Conversion request cancelled while waiting for a slot", "correlation_id", correlationID)
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+
+	log.Debug("Convert request received", "correlation_id", correlationID)
+	ctx := handler.WithCorrelationID(c.Request.Context(), correlationID)
+	resp, err := handler.ExternalAccessHandler(ctx, body)
+	if err != nil {
+		reply := handler.NewErrorReply(err)
+		log.Warn("Conversion failed", "correlation_id", correlationID, "code", reply.Error.Code, "plugin_id", reply.Error.PluginID, "error", err)
+		c.JSON(convertStatus(reply.Error.Code), reply)
+		return
+	}
+
+	log.Debug("Convert request successful", "correlation_id", correlationID)
+	c.Data(http.StatusOK, "application/json", resp)
+}
+
+// conversionMessage returns the message of the conversion requested, the body of the request, or the raw payload of
+// the body wrapped in a message when the distributionId query parameter is set
+func conversionMessage(c *gin.Context) ([]byte, error) {
+	body, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, err
+	}
+	distributionID := c.Query("distributionId")
+	if distributionID == "" {
+		return body, nil
+	}
+	return json.Marshal(handler.Message{
+		Parameters: handler.Parameters{
+			PluginID:       c.Query("pluginId"),
+			PipelineID:     c.Query("pipelineId"),
+			DistributionID: distributionID,
+			RequestFormat:  c.ContentType(),
+			ResponseFormat: c.Query("responseContentType"),
+		},
+		Payload: string(body),
+	})
+}
+
+// convertStatus returns the HTTP status of the error code of a failed conversion
+func convertStatus(code handler.ErrorCode) int {
+	switch code {
+	case handler.CodeBadMessage:
+		return http.StatusBadRequest
+	case handler.CodePluginNotFound:
+		return http.StatusNotFound
+	case handler.CodePluginDisabled:
+		return http.StatusConflict
+	case handler.CodePluginFailed:
+		return http.StatusUnprocessableEntity
+	case handler.CodeInvalidOutput:
+		return http.StatusBadGateway
+	case handler.CodeTimeout:
+		return http.StatusGatewayTimeout
+	default:
+		return http.StatusInternalServerError
+	}
+}
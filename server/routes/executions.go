@@ -0,0 +1,103 @@
+package routes
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/db"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultExecutionsLimit = 50
+	maxExecutionsLimit     = 500
+)
+
+type Executions struct {
+	Executions []model.Execution `json:"executions"`
+	// the number of executions matching the filters
+	Total  int64 `json:"total"`
+	Limit  int   `json:"limit"`
+	Offset int   `json:"offset"`
+}
+
+// GetExecutions retrieves the execution history of the plugins
+//
+//	@Summary		Get the plugin executions
+//	@Description	Retrieve a page of the recorded plugin executions, the most recent first. Test runs are not recorded.
+//	@Tags			Converter Service
+//	@Produce		json
+//	@Param			plugin_id		query		string	false	"Plugin ID"
+//	@Param			distribution_id	query		string	false	"Distribution ID"
+//	@Param			correlation_id	query		string	false	"Correlation ID"
+//	@Param			pipeline_id		query		string	false	"Pipeline ID"
+//	@Param			outcome			query		string	false	"Outcome (succeeded or failed)"
+//	@Param			error_code		query		string	false	"Error code"
+//	@Param			since			query		string	false	"Executions started at or after this time (RFC 3339)"
+//	@Param			until			query		string	false	"Executions started before this time (RFC 3339)"
+//	@Param			limit			query		int		false	"Page size (default 50, at most 500)"
+//	@Param			offset			query		int		false	"Number of executions skipped"
+//	@Success		200				{object}	Executions
+//	@Failure		400				{object}	HTTPError
+//	@Failure		500				{object}	HTTPError
+//	@Router			/executions [get]
+func GetExecutions(c *gin.Context) {
+	log.Debug("GetExecutions request received")
+
+	filter := db.ExecutionFilter{
+		PluginID:       c.Query("plugin_id"),
+		DistributionID: c.Query("distribution_id"),
+		CorrelationID:  c.Query("correlation_id"),
+		PipelineID:     c.Query("pipeline_id"),
+		Outcome:        model.ExecutionOutcome(c.Query("outcome")),
+		ErrorCode:      c.Query("error_code"),
+	}
+	if filter.Outcome != "" && filter.Outcome != model.ExecutionSucceeded && filter.Outcome != model.ExecutionFailed {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "outcome must be either 'succeeded' or 'failed'"})
+		return
+	}
+
+	var err error
+	for param, t := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		if *t, err = time.Parse(time.RFC3339, value); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": param + " must be an RFC 3339 time"})
+			return
+		}
+	}
+
+	limit := defaultExecutionsLimit
+	if value := c.Query("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > maxExecutionsLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and " + strconv.Itoa(maxExecutionsLimit)})
+			return
+		}
+	}
+	offset := 0
+	if value := c.Query("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "offset must be a positive integer"})
+			return
+		}
+	}
+
+	executions, total, err := db.GetExecutions(filter, limit, offset)
+	if err != nil {
+		log.Error("Failed to get executions from DB", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve executions"})
+		return
+	}
+
+	log.Debug("GetExecutions request successful", "count", len(executions), "total", total)
+	c.JSON(http.StatusOK, Executions{
+		Executions: executions,
+		Total:      total,
+		Limit:      limit,
+		Offset:     offset,
+	})
+}
@@ -0,0 +1,479 @@
+package routes
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/db"
+	"github.com/epos-eu/converter-service/handler"
+	"github.com/epos-eu/converter-service/internal/env"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+var (
+	// whether a plugin is disabled when its fixtures fail after it was synced
+	fixturesAutoDisable = false
+	// how often the plugin directories are checked for a sync, 0 to only check after the syncs of the API
+	fixturesSyncPoll = time.Minute
+
+	// the commit each plugin directory was last found at
+	syncedCommits   = map[string]string{}
+	syncedCommitsMu sync.Mutex
+	// the context of the post-sync fixture runs, done on shutdown
+	syncCtx      = context.Background()
+	syncFixtures sync.WaitGroup
+)
+
+func init() {
+	fixturesAutoDisable = env.Get("FIXTURES_AUTO_DISABLE", "false") == "true"
+	fixturesSyncPoll = time.Duration(env.Int("FIXTURES_SYNC_POLL", int(fixturesSyncPoll.Seconds()))) * time.Second
+}
+
+type Fixture struct {
+	Name                *string            `json:"name"`
+	Input               *string            `json:"input"`
+	Expected            *string            `json:"expected"`
+	DistributionID      *string            `json:"distribution_id"`
+	RequestContentType  *string            `json:"request_content_type"`
+	ResponseContentType *string            `json:"response_content_type"`
+	Compare             *model.CompareMode `json:"compare"`
+	Tolerance           *float64           `json:"tolerance"`
+	IgnorePaths         *[]string          `json:"ignore_paths"`
+}
+
+// GetFixtures retrieves the fixtures of a plugin
+//
+//	@Summary		Get the fixtures of a plugin
+//	@Description	Retrieve the fixtures of a plugin, ordered by name
+//	@Tags			Converter Service
+//	@Produce		json
+//	@Param			plugin_id	path		string	true	"Plugin ID"
+//	@Success		200			{array}		model.PluginFixture
+//	@Failure		500			{object}	HTTPError
+//	@Router			/plugins/{plugin_id}/fixtures [get]
+func GetFixtures(c *gin.Context) {
+	pluginID := c.Param("plugin_id")
+	log.Debug("GetFixtures request received", "plugin_id", pluginID)
+
+	fixtures, err := db.GetFixturesByPluginID(pluginID)
+	if err != nil {
+		log.Error("Failed to get fixtures from DB", "plugin_id", pluginID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve fixtures"})
+		return
+	}
+
+	log.Debug("GetFixtures request successful", "plugin_id", pluginID, "count", len(fixtures))
+	c.JSON(http.StatusOK, fixtures)
+}
+
+// GetFixture retrieves a fixture of a plugin
+//
+//	@Summary		Get a fixture
+//	@Description	Retrieve a fixture of a plugin
+//	@Tags			Converter Service
+//	@Produce		json
+//	@Param			plugin_id	path		string	true	"Plugin ID"
+//	@Param			fixture_id	path		string	true	"Fixture ID"
+//	@Success		200			{object}	model.PluginFixture
+//	@Failure		404			{object}	HTTPError
+//	@Failure		500			{object}	HTTPError
+//	@Router			/plugins/{plugin_id}/fixtures/{fixture_id} [get]
+func GetFixture(c *gin.Context) {
+	pluginID, id := c.Param("plugin_id"), c.Param("fixture_id")
+	log.Debug("GetFixture request received", "plugin_id", pluginID, "fixture_id", id)
+
+	fixture, err := db.GetFixtureByID(pluginID, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("Fixture not found in DB", "plugin_id", pluginID, "fixture_id", id)
+			c.JSON(http.StatusNotFound, gin.H{"error": "No fixture found with fixture_id: " + id})
+			return
+		}
+		log.Error("Failed to get fixture from DB", "plugin_id", pluginID, "fixture_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve fixture"})
+		return
+	}
+
+	log.Debug("GetFixture request successful", "plugin_id", pluginID, "fixture_id", id)
+	c.JSON(http.StatusOK, fixture)
+}
+
+// CreateFixture creates a new fixture for a plugin
+//
+//	@Summary		Create a new fixture
+//	@Description	Create a fixture of a plugin: an input payload and the output the plugin must write for it, compared either exactly or by JSON structure with a numeric tolerance and ignored paths. The fixture ID will be assigned upon creation.
+//	@Tags			Converter Service
+//	@Accept			json
+//	@Produce		json
+//	@Param			plugin_id	path		string				true	"Plugin ID"
+//	@Param			fixture		body		Fixture				true	"Fixture object for creation"
+//	@Success		201			{object}	model.PluginFixture
+//	@Failure		400			{object}	HTTPError
+//	@Failure		404			{object}	HTTPError
+//	@Failure		500			{object}	HTTPError
+//	@Router			/plugins/{plugin_id}/fixtures [post]
+func CreateFixture(c *gin.Context) {
+	pluginID := c.Param("plugin_id")
+	log.Debug("CreateFixture request received", "plugin_id", pluginID)
+
+	var newFixture Fixture
+	if err := c.ShouldBindJSON(&newFixture); err != nil {
+		log.Warn("Failed to bind JSON for fixture creation", "plugin_id", pluginID, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format: " + err.Error()})
+		return
+	}
+
+	if _, err := db.GetPluginByID(pluginID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("Plugin of the fixture not found in DB", "plugin_id", pluginID)
+			c.JSON(http.StatusNotFound, gin.H{"error": "No plugin found with plugin_id: " + pluginID})
+			return
+		}
+		log.Error("Failed to get plugin of the fixture", "plugin_id", pluginID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve plugin"})
+		return
+	}
+
+	fixtureToCreate := mergeFixtureUpdate(newFixture, model.PluginFixture{
+		ID:          uuid.NewString(),
+		PluginID:    pluginID,
+		Compare:     model.CompareJSON,
+		IgnorePaths: []string{},
+	})
+	if err := fixtureToCreate.Validate(); err != nil {
+		log.Warn("Fixture validation failed on create", "plugin_id", pluginID, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+		return
+	}
+
+	createdFixture, err := db.CreateFixture(fixtureToCreate)
+	if err != nil {
+		log.Error("Failed to create fixture in DB", "plugin_id", pluginID, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save new fixture"})
+		return
+	}
+
+	log.Info("Fixture created successfully", "plugin_id", pluginID, "fixture_id", createdFixture.ID)
+	c.JSON(http.StatusCreated, createdFixture)
+}
+
+// UpdateFixture updates a fixture of a plugin
+//
+//	@Summary		Update a fixture
+//	@Description	Update an existing fixture of a plugin. Even if explicitly passed in the body, the Id and the plugin of the fixture will not be changed
+//	@Tags			Converter Service
+//	@Accept			json
+//	@Produce		json
+//	@Param			plugin_id	path		string	true	"Plugin ID"
+//	@Param			fixture_id	path		string	true	"Fixture ID"
+//	@Param			fixture		body		Fixture	true	"Fixture object"
+//	@Success		200			{object}	model.PluginFixture
+//	@Failure		400			{object}	HTTPError
+//	@Failure		404			{object}	HTTPError
+//	@Failure		500			{object}	HTTPError
+//	@Router			/plugins/{plugin_id}/fixtures/{fixture_id} [put]
+func UpdateFixture(c *gin.Context) {
+	pluginID, id := c.Param("plugin_id"), c.Param("fixture_id")
+	log.Debug("UpdateFixture request received", "plugin_id", pluginID, "fixture_id", id)
+
+	var fixtureUpdate Fixture
+	if err := c.ShouldBindJSON(&fixtureUpdate); err != nil {
+		log.Warn("Failed to bind JSON for fixture update", "plugin_id", pluginID, "fixture_id", id, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format: " + err.Error()})
+		return
+	}
+
+	fixture, err := db.GetFixtureByID(pluginID, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("Fixture to update not found in DB", "plugin_id", pluginID, "fixture_id", id)
+			c.JSON(http.StatusNotFound, gin.H{"error": "No fixture found with fixture_id: " + id})
+			return
+		}
+		log.Error("Failed to get fixture for update", "plugin_id", pluginID, "fixture_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve existing fixture"})
+		return
+	}
+
+	updatedFixture := mergeFixtureUpdate(fixtureUpdate, fixture)
+	if err := updatedFixture.Validate(); err != nil {
+		log.Warn("Fixture validation failed on update", "plugin_id", pluginID, "fixture_id", id, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+		return
+	}
+
+	if err := db.UpdateFixture(updatedFixture); err != nil {
+		log.Error("Failed to update fixture in DB", "plugin_id", pluginID, "fixture_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save fixture update"})
+		return
+	}
+
+	log.Info("Fixture updated successfully", "plugin_id", pluginID, "fixture_id", id)
+	c.JSON(http.StatusOK, updatedFixture)
+}
+
+// DeleteFixture deletes a fixture of a plugin
+//
+//	@Summary		Delete a fixture
+//	@Description	Delete a fixture of a plugin
+//	@Tags			Converter Service
+//	@Produce		json
+//	@Param			plugin_id	path		string	true	"Plugin ID"
+//	@Param			fixture_id	path		string	true	"Fixture ID"
+//	@Success		200			{object}	model.PluginFixture
+//	@Failure		404			{object}	HTTPError
+//	@Failure		500			{object}	HTTPError
+//	@Router			/plugins/{plugin_id}/fixtures/{fixture_id} [delete]
+func DeleteFixture(c *gin.Context) {
+	pluginID, id := c.Param("plugin_id"), c.Param("fixture_id")
+	log.Debug("DeleteFixture request received", "plugin_id", pluginID, "fixture_id", id)
+
+	deletedFixture, err := db.DeleteFixture(pluginID, id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("Fixture to delete not found in DB", "plugin_id", pluginID, "fixture_id", id)
+			c.JSON(http.StatusNotFound, gin.H{"error": "Fixture not found"})
+			return
+		}
+		log.Error("Failed to delete fixture from DB", "plugin_id", pluginID, "fixture_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete fixture from database"})
+		return
+	}
+
+	log.Info("Fixture deleted successfully", "plugin_id", pluginID, "fixture_id", id)
+	c.JSON(http.StatusOK, deletedFixture)
+}
+
+// RunPluginFixtures runs the fixtures of a plugin
+//
+//	@Summary		Run the fixtures of a plugin
+//	@Description	Runs every fixture of a plugin through the same execution path as the conversions, even if the plugin is not enabled, and reports how each output differs from the expected one. With disable=true, the plugin is disabled when a fixture fails.
+//	@Tags			Converter Service
+//	@Produce		json
+//	@Param			plugin_id	path		string	true	"Plugin ID"
+//	@Param			disable		query		bool	false	"Disable the plugin when a fixture fails"
+//	@Success		200			{object}	handler.FixtureReport
+//	@Failure		404			{object}	handler.ErrorReply
+//	@Failure		409			{object}	handler.ErrorReply
+//	@Failure		500			{object}	handler.ErrorReply
+//	@Router			/plugins/{plugin_id}/fixtures/run [post]
+func RunPluginFixtures(c *gin.Context) {
+	id := c.Param("plugin_id")
+	log.Debug("RunPluginFixtures request received", "plugin_id", id)
+
+	// fixture runs share the slots of the HTTP conversions
+	select {
+	case convertSlots <- struct{}{}:
+		defer func() { <-convertSlots }()
+	case <-c.Request.Context().Done():
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx := handler.WithCorrelationID(c.Request.Context(), "fixtures-"+uuid.NewString())
+	report, err := handler.RunFixtures(ctx, id, c.Query("disable") == "true")
+	if err != nil {
+		reply := handler.NewErrorReply(err)
+		log.Warn("Plugin fixtures could not run", "plugin_id", id, "code", reply.Error.Code, "error", err)
+		c.JSON(convertStatus(reply.Error.Code), reply)
+		return
+	}
+
+	log.Debug("RunPluginFixtures request successful", "plugin_id", id, "passed", report.Passed, "disabled", report.Disabled)
+	c.JSON(http.StatusOK, report)
+}
+
+// RunAllFixtures runs the fixtures of every plugin
+//
+//	@Summary		Run the fixtures of every plugin
+//	@Description	Runs the fixtures of every plugin having some, one plugin after the other, and reports how each output differs from the expected one. A plugin whose fixtures could not be run (e.g. not installed) has the error in its report. With disable=true, the plugins whose fixtures fail are disabled.
+//	@Tags			Converter Service
+//	@Produce		json
+//	@Param			disable	query		bool	false	"Disable the plugins whose fixtures fail"
+//	@Success		200		{array}		handler.FixtureReport
+//	@Failure		500		{object}	HTTPError
+//	@Router			/fixtures/run [post]
+func RunAllFixtures(c *gin.Context) {
+	log.Debug("RunAllFixtures request received")
+
+	pluginIDs, err := db.GetPluginIDsWithFixtures()
+	if err != nil {
+		log.Error("Failed to get the plugins with fixtures from DB", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve fixtures"})
+		return
+	}
+
+	select {
+	case convertSlots <- struct{}{}:
+		defer func() { <-convertSlots }()
+	case <-c.Request.Context().Done():
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx := handler.WithCorrelationID(c.Request.Context(), "fixtures-"+uuid.NewString())
+	disable := c.Query("disable") == "true"
+	reports := make([]handler.FixtureReport, 0, len(pluginIDs))
+	for _, id := range pluginIDs {
+		report, err := handler.RunFixtures(ctx, id, disable)
+		if err != nil {
+			reply := handler.NewErrorReply(err)
+			log.Warn("Plugin fixtures could not run", "plugin_id", id, "code", reply.Error.Code, "error", err)
+			report.Error = &reply.Error
+		}
+		reports = append(reports, report)
+	}
+
+	log.Debug("RunAllFixtures request successful", "count", len(reports))
+	c.JSON(http.StatusOK, reports)
+}
+
+// WatchSyncs runs the fixtures of the plugins every time the converter-routine syncs them to another commit, whether
+// the sync comes from the API or from its periodic pulls, until ctx is done. The commits found at startup are taken as
+// already checked.
+func WatchSyncs(ctx context.Context) {
+	syncCtx = ctx
+	plugins, err := db.GetPlugins()
+	if err != nil {
+		log.Error("Failed to get the plugins to watch for syncs", "error", err)
+	}
+	for _, plugin := range plugins {
+		commit, err := handler.PluginRevision(plugin.ID)
+		if err != nil {
+			log.Warn("Failed to get the commit of the plugin", "plugin_id", plugin.ID, "error", err)
+			continue
+		}
+		syncedCommits[plugin.ID] = commit
+	}
+	if fixturesSyncPoll <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(fixturesSyncPoll)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				plugins, err := db.GetPlugins()
+				if err != nil {
+					log.Error("Failed to get the plugins to watch for syncs", "error", err)
+					continue
+				}
+				for _, plugin := range plugins {
+					checkSync(plugin.ID)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// ShutdownSyncs waits for the post-sync fixture runs, which are interrupted once the context given to WatchSyncs is
+// done, until ctx is done
+func ShutdownSyncs(ctx context.Context) {
+	done := make(chan struct{})
+	go func() {
+		syncFixtures.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		log.Warn("Post-sync fixtures still running at shutdown")
+	}
+}
+
+// checkSync runs the fixtures of the plugin in the background if its directory is at another commit than when it was
+// last checked
+func checkSync(pluginID string) {
+	if syncCtx.Err() != nil {
+		return
+	}
+	commit, err := handler.PluginRevision(pluginID)
+	if err != nil {
+		log.Warn("Failed to get the commit of the plugin", "plugin_id", pluginID, "error", err)
+		return
+	}
+	syncedCommitsMu.Lock()
+	previous := syncedCommits[pluginID]
+	syncedCommits[pluginID] = commit
+	syncedCommitsMu.Unlock()
+	if commit == "" || commit == previous {
+		return
+	}
+
+	syncFixtures.Add(1)
+	go func() {
+		defer syncFixtures.Done()
+		runFixturesAfterSync(syncCtx, pluginID, commit)
+	}()
+}
+
+// runFixturesAfterSync runs the fixtures of a plugin that was just synced to commit, disabling it when they fail if
+// FIXTURES_AUTO_DISABLE is set
+func runFixturesAfterSync(ctx context.Context, pluginID, commit string) {
+	select {
+	case convertSlots <- struct{}{}:
+		defer func() { <-convertSlots }()
+	case <-ctx.Done():
+		return
+	}
+
+	ctx = handler.WithCorrelationID(ctx, "fixtures-"+uuid.NewString())
+	report, err := handler.RunFixtures(ctx, pluginID, fixturesAutoDisable)
+	if err != nil {
+		log.Warn("Post-sync fixtures could not run", "plugin_id", pluginID, "commit", commit, "error", err)
+		return
+	}
+	if len(report.Fixtures) == 0 {
+		return
+	}
+	if !report.Passed {
+		log.Warn("Post-sync fixtures failed", "plugin_id", pluginID, "commit", commit, "fixtures", len(report.Fixtures), "disabled", report.Disabled)
+		return
+	}
+	log.Info("Post-sync fixtures passed", "plugin_id", pluginID, "commit", commit, "fixtures", len(report.Fixtures))
+}
+
+// mergeFixtureUpdate returns the fixture with the fields set in the update replaced, the id and the plugin are kept
+func mergeFixtureUpdate(update Fixture, old model.PluginFixture) model.PluginFixture {
+	merged := old
+
+	if update.Name != nil {
+		merged.Name = *update.Name
+	}
+	if update.Input != nil {
+		merged.Input = *update.Input
+	}
+	if update.Expected != nil {
+		merged.Expected = *update.Expected
+	}
+	if update.DistributionID != nil {
+		merged.DistributionID = *update.DistributionID
+	}
+	if update.RequestContentType != nil {
+		merged.RequestContentType = *update.RequestContentType
+	}
+	if update.ResponseContentType != nil {
+		merged.ResponseContentType = *update.ResponseContentType
+	}
+	if update.Compare != nil {
+		merged.Compare = *update.Compare
+	}
+	if update.Tolerance != nil {
+		merged.Tolerance = *update.Tolerance
+	}
+	if update.IgnorePaths != nil {
+		merged.IgnorePaths = *update.IgnorePaths
+	}
+
+	return merged
+}
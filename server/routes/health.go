@@ -7,36 +7,37 @@ import (
 	"github.com/epos-eu/converter-service/db"
 	"github.com/epos-eu/converter-service/logging"
 	"github.com/epos-eu/converter-service/rabbit"
+	"github.com/epos-eu/converter-service/transport"
 	"github.com/gin-gonic/gin"
 )
 
 var healthLog = logging.Get("health")
 
 type HealthHandler struct {
-	Broker *rabbit.BrokerConfig
+	Transport transport.Transport
 }
 
 // Health check
 func (h *HealthHandler) Health(c *gin.Context) {
-	err := health(h.Broker)
+	err := health(h.Transport)
 	if err != nil {
 		healthLog.Error("health check failed", "error", err)
 		c.String(http.StatusServiceUnavailable, "Unhealthy: ", err.Error())
 		return
 	} else {
+		if broker, ok := h.Transport.(*rabbit.BrokerConfig); ok {
+			c.String(http.StatusOK, "Healthy, broker %s", broker.Status().State)
+			return
+		}
 		c.String(http.StatusOK, "Healthy")
 		return
 	}
 }
 
-func health(broker *rabbit.BrokerConfig) error {
-	ch, err := broker.Conn.Channel()
-	if err != nil {
-		return fmt.Errorf("can't open rabbit channel: %w", err)
-	}
-	err = ch.Close()
-	if err != nil {
-		return fmt.Errorf("can't close rabbit channel: %w", err)
+func health(t transport.Transport) error {
+	// the transport reconnects by itself, it is only unhealthy once it keeps failing
+	if err := t.Health(); err != nil {
+		return err
 	}
 
 	db := db.Get()
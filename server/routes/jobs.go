@@ -0,0 +1,190 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/db"
+	"github.com/epos-eu/converter-service/jobs"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// CreateJob creates an asynchronous conversion job
+//
+//	@Summary		Create a conversion job
+//	@Description	Create a job converting a payload in the background, the body is the same as for /convert. The job and its result are deleted once they expire.
+//	@Tags			Converter Service
+//	@Accept			json
+//	@Produce		json
+//	@Param			message				body		handler.Message	false	"Message, or raw payload"
+//	@Param			distributionId		query		string			false	"Distribution ID, for a raw payload"
+//	@Param			pluginId			query		string			false	"Plugin ID, for a raw payload"
+//	@Param			pipelineId			query		string			false	"Pipeline ID, for a raw payload"
+//	@Param			responseContentType	query		string			false	"Response content type, for a raw payload"
+//	@Success		202					{object}	model.ConversionJob
+//	@Failure		400					{object}	HTTPError
+//	@Failure		500					{object}	HTTPError
+//	@Router			/jobs [post]
+func CreateJob(c *gin.Context) {
+	log.Debug("CreateJob request received")
+
+	body, err := conversionMessage(c)
+	if err != nil {
+		log.Warn("Failed to read the conversion request", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read the request body"})
+		return
+	}
+
+	job, err := jobs.Submit(body)
+	if err != nil {
+		if errors.Is(err, jobs.ErrBadMessage) {
+			log.Warn("Invalid conversion message", "error", err)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		log.Error("Failed to create job", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create job"})
+		return
+	}
+
+	log.Debug("CreateJob request successful", "job_id", job.ID)
+	c.Header("Location", c.FullPath()+"/"+job.ID)
+	c.JSON(http.StatusAccepted, job)
+}
+
+// GetJob retrieves the state of a conversion job
+//
+//	@Summary		Get a conversion job
+//	@Description	Retrieve the state of a conversion job, with its timings and its error if it failed
+//	@Tags			Converter Service
+//	@Produce		json
+//	@Param			job_id	path		string	true	"Job ID"
+//	@Success		200		{object}	model.ConversionJob
+//	@Failure		404		{object}	HTTPError
+//	@Failure		500		{object}	HTTPError
+//	@Router			/jobs/{job_id} [get]
+func GetJob(c *gin.Context) {
+	id := c.Param("job_id")
+	log.Debug("GetJob request received", "job_id", id)
+
+	job, err := db.GetJobByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("Job not found in DB", "job_id", id)
+			c.JSON(http.StatusNotFound, gin.H{"error": "No job found with job_id: " + id})
+			return
+		}
+		log.Error("Failed to get job from DB", "job_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve job"})
+		return
+	}
+
+	log.Debug("GetJob request successful", "job_id", id, "state", job.State)
+	c.JSON(http.StatusOK, job)
+}
+
+// GetJobResult retrieves the result of a conversion job
+//
+//	@Summary		Get the result of a conversion job
+//	@Description	Retrieve the converted content of a job that succeeded, as the /convert endpoint returns it
+//	@Tags			Converter Service
+//	@Produce		json
+//	@Param			job_id	path		string	true	"Job ID"
+//	@Success		200		{object}	handler.Response
+//	@Failure		404		{object}	HTTPError
+//	@Failure		409		{object}	HTTPError
+//	@Failure		500		{object}	HTTPError
+//	@Router			/jobs/{job_id}/result [get]
+func GetJobResult(c *gin.Context) {
+	id := c.Param("job_id")
+	log.Debug("GetJobResult request received", "job_id", id)
+
+	job, err := db.GetJobByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("Job not found in DB", "job_id", id)
+			c.JSON(http.StatusNotFound, gin.H{"error": "No job found with job_id: " + id})
+			return
+		}
+		log.Error("Failed to get job from DB", "job_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve job"})
+		return
+	}
+
+	if job.State != model.JobSucceeded {
+		log.Warn("Job has no result", "job_id", id, "state", job.State)
+		c.JSON(http.StatusConflict, gin.H{"error": "The job is " + string(job.State) + ", it has no result", "job": job})
+		return
+	}
+
+	if job.ResultOID == nil {
+		log.Error("Job succeeded without a result", "job_id", id)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve job result"})
+		return
+	}
+
+	// the result is streamed from the database as it is sent
+	log.Debug("GetJobResult request successful", "job_id", id, "size", job.ResultSize)
+	c.DataFromReader(http.StatusOK, job.ResultSize, "application/json", db.JobResult(c.Request.Context(), *job.ResultOID, job.ResultSize), nil)
+}
+
+// DeleteJob cancels a conversion job, or deletes it once it is finished
+//
+//	@Summary		Cancel or delete a conversion job
+//	@Description	Cancel a job that is queued or running, killing its plugin. A finished job is deleted with its result.
+//	@Tags			Converter Service
+//	@Produce		json
+//	@Param			job_id	path		string	true	"Job ID"
+//	@Success		200		{object}	model.ConversionJob
+//	@Failure		404		{object}	HTTPError
+//	@Failure		500		{object}	HTTPError
+//	@Router			/jobs/{job_id} [delete]
+func DeleteJob(c *gin.Context) {
+	id := c.Param("job_id")
+	log.Debug("DeleteJob request received", "job_id", id)
+
+	job, err := db.GetJobByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("Job not found in DB", "job_id", id)
+			c.JSON(http.StatusNotFound, gin.H{"error": "No job found with job_id: " + id})
+			return
+		}
+		log.Error("Failed to get job from DB", "job_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve job"})
+		return
+	}
+
+	if !job.State.Finished() {
+		err = jobs.Cancel(id)
+		if err == nil {
+			job, err = db.GetJobByID(id)
+			if err != nil {
+				log.Error("Failed to get job from DB", "job_id", id, "error", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve job"})
+				return
+			}
+			log.Debug("DeleteJob request successful, job cancelled", "job_id", id)
+			c.JSON(http.StatusOK, job)
+			return
+		}
+		if !errors.Is(err, jobs.ErrJobFinished) {
+			log.Error("Failed to cancel job", "job_id", id, "error", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel job"})
+			return
+		}
+		// the job finished in the meantime, it is deleted
+	}
+
+	err = db.DeleteJob(id)
+	if err != nil {
+		log.Error("Failed to delete job from DB", "job_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete job"})
+		return
+	}
+
+	log.Debug("DeleteJob request successful, job deleted", "job_id", id)
+	c.JSON(http.StatusOK, job)
+}
@@ -4,7 +4,9 @@ import (
 	"net/http"
 
 	"github.com/epos-eu/converter-service/db"
+	"github.com/epos-eu/converter-service/handler"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 // EnablePlugin enables a plugin by its ID.
@@ -52,3 +54,51 @@ func DisablePlugin(c *gin.Context) {
 
 	c.JSON(http.StatusOK, "Plugin "+id+" disabled correctly")
 }
+
+// TestPlugin runs a plugin on a sample payload.
+//
+//	@Summary		Test a plugin
+//	@Description	Runs a plugin on a sample payload through the same execution path as the conversions, without publishing anything, and reports its output, exit code, stdout, stderr, wall and CPU time, and the validation of its output. The plugin does not have to be enabled.
+//	@Tags			Converter Service
+//	@Accept			json
+//	@Produce		json
+//	@Param			plugin_id	path		string				true	"Plugin ID"
+//	@Param			message		body		handler.Message		true	"Sample payload, and the parameters given to the plugin"
+//	@Success		200			{object}	handler.TestReport
+//	@Failure		400			{object}	HTTPError
+//	@Failure		404			{object}	handler.ErrorReply
+//	@Failure		409			{object}	handler.ErrorReply
+//	@Failure		500			{object}	handler.ErrorReply
+//	@Router			/plugins/{plugin_id}/test [post]
+func TestPlugin(c *gin.Context) {
+	id := c.Param("plugin_id")
+	log.Debug("TestPlugin request received", "plugin_id", id)
+
+	var message handler.Message
+	if err := c.ShouldBindJSON(&message); err != nil {
+		log.Warn("Invalid test request", "plugin_id", id, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request body: " + err.Error()})
+		return
+	}
+
+	// test runs share the slots of the HTTP conversions
+	select {
+	case convertSlots <- struct{}{}:
+		defer func() { <-convertSlots }()
+	case <-c.Request.Context().Done():
+		c.AbortWithStatus(http.StatusServiceUnavailable)
+		return
+	}
+
+	ctx := handler.WithCorrelationID(c.Request.Context(), "test-"+uuid.NewString())
+	report, err := handler.TestPlugin(ctx, id, message)
+	if err != nil {
+		reply := handler.NewErrorReply(err)
+		log.Warn("Plugin test could not run", "plugin_id", id, "code", reply.Error.Code, "error", err)
+		c.JSON(convertStatus(reply.Error.Code), reply)
+		return
+	}
+
+	log.Debug("TestPlugin request successful", "plugin_id", id, "success", report.Success)
+	c.JSON(http.StatusOK, report)
+}
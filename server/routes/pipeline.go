@@ -0,0 +1,259 @@
+package routes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/db"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+type Pipeline struct {
+	Name        *string               `json:"name"`
+	Description *string               `json:"description"`
+	Steps       *[]model.PipelineStep `json:"steps"`
+	Timeout     *int                  `json:"timeout"`
+}
+
+// GetAllPipelines retrieves all pipelines from the database
+//
+//	@Summary		Get all pipelines
+//	@Description	Retrieve all pipelines from the database
+//	@Tags			Converter Service
+//	@Produce		json
+//	@Success		200	{array}		model.Pipeline
+//	@Failure		404	{object}	HTTPError
+//	@Failure		500	{object}	HTTPError
+//	@Router			/pipelines [get]
+func GetAllPipelines(c *gin.Context) {
+	log.Debug("GetAllPipelines request received")
+
+	pipelines, err := db.GetPipelines()
+	if err != nil {
+		log.Error("Failed to get pipelines from DB", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pipelines"})
+		return
+	}
+
+	if len(pipelines) == 0 {
+		log.Warn("No pipelines found in DB")
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pipelines found"})
+		return
+	}
+
+	log.Debug("GetAllPipelines request successful", "count", len(pipelines))
+	c.JSON(http.StatusOK, pipelines)
+}
+
+// GetPipeline retrieves a pipeline from the database
+//
+//	@Summary		Get a pipeline
+//	@Description	Retrieve a pipeline from the database
+//	@Tags			Converter Service
+//	@Produce		json
+//	@Param			pipeline_id	path		string	true	"Pipeline ID"
+//	@Success		200			{object}	model.Pipeline
+//	@Failure		404			{object}	HTTPError
+//	@Failure		500			{object}	HTTPError
+//	@Router			/pipelines/{pipeline_id} [get]
+func GetPipeline(c *gin.Context) {
+	id := c.Param("pipeline_id")
+	log.Debug("GetPipeline request received", "pipeline_id", id)
+
+	pipeline, err := db.GetPipelineByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("Pipeline not found in DB", "pipeline_id", id)
+			c.JSON(http.StatusNotFound, gin.H{"error": "No pipeline found with pipeline_id: " + id})
+			return
+		}
+		log.Error("Failed to get pipeline from DB", "pipeline_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve pipeline"})
+		return
+	}
+
+	log.Debug("GetPipeline request successful", "pipeline_id", id)
+	c.JSON(http.StatusOK, pipeline)
+}
+
+// CreatePipeline creates a new pipeline in the database
+//
+//	@Summary		Create a new pipeline
+//	@Description	Create a new pipeline in the database. The pipeline ID will be assigned upon creation. The output format of each step must match the input format of the next one.
+//	@Tags			Converter Service
+//	@Accept			json
+//	@Produce		json
+//	@Param			pipeline	body		Pipeline	true	"Pipeline object for creation"
+//	@Success		201			{object}	model.Pipeline
+//	@Failure		400			{object}	HTTPError
+//	@Failure		500			{object}	HTTPError
+//	@Router			/pipelines [post]
+func CreatePipeline(c *gin.Context) {
+	log.Debug("CreatePipeline request received")
+
+	var newPipeline Pipeline
+	if err := c.ShouldBindJSON(&newPipeline); err != nil {
+		log.Warn("Failed to bind JSON for pipeline creation", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format: " + err.Error()})
+		return
+	}
+
+	pipelineToCreate := mergePipelineUpdate(newPipeline, model.Pipeline{
+		ID: uuid.NewString(),
+	})
+	if err := validatePipeline(pipelineToCreate); err != nil {
+		log.Warn("Pipeline validation failed on create", "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+		return
+	}
+
+	createdPipeline, err := db.CreatePipeline(pipelineToCreate)
+	if err != nil {
+		log.Error("Failed to create pipeline in DB", "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save new pipeline"})
+		return
+	}
+
+	log.Info("Pipeline created successfully", "pipeline_id", createdPipeline.ID)
+	c.JSON(http.StatusCreated, createdPipeline)
+}
+
+// UpdatePipeline updates a pipeline in the database
+//
+//	@Summary		Update a pipeline
+//	@Description	Update an existing pipeline in the database. Even if explicitly passed in the body, the Id of the pipeline will not be changed
+//	@Tags			Converter Service
+//	@Accept			json
+//	@Produce		json
+//	@Param			pipeline_id	path		string		true	"Pipeline ID"
+//	@Param			pipeline	body		Pipeline	true	"Pipeline object"
+//	@Success		200			{object}	model.Pipeline
+//	@Failure		400			{object}	HTTPError
+//	@Failure		404			{object}	HTTPError
+//	@Failure		500			{object}	HTTPError
+//	@Router			/pipelines/{pipeline_id} [put]
+func UpdatePipeline(c *gin.Context) {
+	id := c.Param("pipeline_id")
+	log.Debug("UpdatePipeline request received", "pipeline_id", id)
+
+	var pipelineUpdate Pipeline
+	if err := c.ShouldBindJSON(&pipelineUpdate); err != nil {
+		log.Warn("Failed to bind JSON for pipeline update", "pipeline_id", id, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid JSON format: " + err.Error()})
+		return
+	}
+
+	pipeline, err := db.GetPipelineByID(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("Pipeline to update not found in DB", "pipeline_id", id)
+			c.JSON(http.StatusNotFound, gin.H{"error": "No pipeline found with pipeline_id: " + id})
+			return
+		}
+		log.Error("Failed to get pipeline for update", "pipeline_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve existing pipeline"})
+		return
+	}
+
+	updatedPipeline := mergePipelineUpdate(pipelineUpdate, pipeline)
+	if err := validatePipeline(updatedPipeline); err != nil {
+		log.Warn("Pipeline validation failed on update", "pipeline_id", id, "error", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
+		return
+	}
+
+	if err := db.UpdatePipeline(updatedPipeline); err != nil {
+		log.Error("Failed to update pipeline in DB", "pipeline_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save pipeline update"})
+		return
+	}
+
+	log.Info("Pipeline updated successfully", "pipeline_id", id)
+	c.JSON(http.StatusOK, updatedPipeline)
+}
+
+// DeletePipeline deletes a pipeline from the database
+//
+//	@Summary		Delete a pipeline
+//	@Description	Delete a pipeline from the database. A pipeline can't be deleted while relations point at it
+//	@Tags			Converter Service
+//	@Produce		json
+//	@Param			pipeline_id	path		string	true	"Pipeline ID"
+//	@Success		200			{object}	model.Pipeline
+//	@Failure		404			{object}	HTTPError
+//	@Failure		409			{object}	HTTPError
+//	@Failure		500			{object}	HTTPError
+//	@Router			/pipelines/{pipeline_id} [delete]
+func DeletePipeline(c *gin.Context) {
+	id := c.Param("pipeline_id")
+	log.Debug("DeletePipeline request received", "pipeline_id", id)
+
+	relations, err := db.CountRelationsByPipelineID(id)
+	if err != nil {
+		log.Error("Failed to count the relations of the pipeline", "pipeline_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete pipeline from database"})
+		return
+	}
+	if relations > 0 {
+		log.Warn("Pipeline to delete still has relations", "pipeline_id", id, "relations", relations)
+		c.JSON(http.StatusConflict, gin.H{"error": "The pipeline is used by plugin relations, delete them first"})
+		return
+	}
+
+	deletedPipeline, err := db.DeletePipeline(id)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Warn("Pipeline to delete not found in DB", "pipeline_id", id)
+			c.JSON(http.StatusNotFound, gin.H{"error": "Pipeline not found"})
+			return
+		}
+		log.Error("Failed to delete pipeline from DB", "pipeline_id", id, "error", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete pipeline from database"})
+		return
+	}
+
+	log.Info("Pipeline deleted successfully", "pipeline_id", deletedPipeline.ID)
+	c.JSON(http.StatusOK, deletedPipeline)
+}
+
+// validatePipeline validates the pipeline and checks that the plugins of its steps exist
+func validatePipeline(pipeline model.Pipeline) error {
+	if err := pipeline.Validate(); err != nil {
+		return err
+	}
+	for _, step := range pipeline.Steps {
+		if _, err := db.GetPluginByID(step.PluginID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errors.New("no plugin found with plugin_id: " + step.PluginID)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// mergePipelineUpdate takes the update payload and the existing pipeline data, returning a new model.Pipeline
+// representing the merged state. Fields are updated only if the corresponding pointer in 'update' is not nil.
+func mergePipelineUpdate(update Pipeline, old model.Pipeline) model.Pipeline {
+	merged := old
+
+	// explicitly ignoring the id, using the old one
+
+	if update.Name != nil {
+		merged.Name = *update.Name
+	}
+	if update.Description != nil {
+		merged.Description = *update.Description
+	}
+	if update.Steps != nil {
+		merged.Steps = *update.Steps
+	}
+	if update.Timeout != nil {
+		merged.Timeout = *update.Timeout
+	}
+
+	return merged
+}
@@ -89,6 +89,10 @@ type Plugin struct {
 	Executable  *string                  `json:"executable"`
 	Arguments   *string                  `json:"arguments"`
 	Enabled     *bool                    `json:"enabled"`
+	Timeout     *int                     `json:"timeout"`
+	Limits      *model.ResourceLimits    `json:"limits"`
+	Sandbox     *model.SandboxPolicy     `json:"sandbox"`
+	Protocol    *model.Protocol          `json:"protocol"`
 }
 
 // UpdatePlugin updates a plugin in the database
@@ -167,6 +171,9 @@ func UpdatePlugin(c *gin.Context) {
 			return
 		}
 		log.Debug("Post-update clean and sync successful", "plugin_id", updatedPlugin.ID)
+
+		// a new version may break the conversions, the fixtures catch it in the background
+		checkSync(updatedPlugin.ID)
 	}
 
 	log.Info("Plugin updated successfully", "plugin_id", updatedPlugin.ID, "sync_required", needsSync)
@@ -235,6 +242,7 @@ func CreatePlugin(c *gin.Context) {
 	pluginToCreate := mergePluginUpdate(newPlugin, model.Plugin{
 		ID:        uuid.NewString(),
 		Installed: false,
+		Protocol:  model.ProtocolOneshot,
 	})
 
 	if err := pluginToCreate.Validate(); err != nil {
@@ -261,6 +269,9 @@ func CreatePlugin(c *gin.Context) {
 		return
 	}
 
+	// record the first commit of the plugin, the fixtures attached to it later run on the next syncs
+	checkSync(createdPlugin.ID)
+
 	log.Info("Plugin created successfully", "plugin_id", createdPlugin.ID)
 	c.JSON(http.StatusCreated, createdPlugin)
 }
@@ -301,6 +312,18 @@ func mergePluginUpdate(update Plugin, old model.Plugin) model.Plugin {
 	if update.Enabled != nil {
 		merged.Enabled = *update.Enabled
 	}
+	if update.Timeout != nil {
+		merged.Timeout = *update.Timeout
+	}
+	if update.Limits != nil {
+		merged.Limits = *update.Limits
+	}
+	if update.Sandbox != nil {
+		merged.Sandbox = *update.Sandbox
+	}
+	if update.Protocol != nil {
+		merged.Protocol = *update.Protocol
+	}
 
 	return merged
 }
@@ -2,6 +2,7 @@ package routes
 
 import (
 	"errors"
+	"fmt"
 	"net/http"
 
 	"github.com/epos-eu/converter-service/dao/model"
@@ -12,8 +13,9 @@ import (
 )
 
 type DistributionInfo struct {
-	InstanceID string                      `json:"instance_id"`
-	Relations  []PluginWithRelationDetails `json:"relations"`
+	InstanceID string                        `json:"instance_id"`
+	Relations  []PluginWithRelationDetails   `json:"relations"`
+	Pipelines  []PipelineWithRelationDetails `json:"pipelines"`
 }
 
 type PluginWithRelationDetails struct {
@@ -21,6 +23,11 @@ type PluginWithRelationDetails struct {
 	Relation model.PluginRelation `json:"relation"`
 }
 
+type PipelineWithRelationDetails struct {
+	Pipeline model.Pipeline       `json:"pipeline"`
+	Relation model.PluginRelation `json:"relation"`
+}
+
 // GetAllPluginRelations retrieves all plugin relations from the database
 //
 //	@Summary		Get all plugin relations
@@ -84,6 +91,7 @@ func GetPluginRelation(c *gin.Context) {
 
 type PluginRelationUpdate struct {
 	PluginID     *string `json:"plugin_id"`
+	PipelineID   *string `json:"pipeline_id"`
 	RelationID   *string `json:"relation_id"`
 	InputFormat  *string `json:"input_format"`
 	OutputFormat *string `json:"output_format"`
@@ -134,6 +142,11 @@ func UpdatePluginRelation(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
 		return
 	}
+	if status, err := checkRelationPipeline(newRelation); err != nil {
+		log.Warn("Plugin relation pipeline check failed on update", "relation_id", id, "pipeline_id", newRelation.PipelineID, "error", err)
+		c.JSON(status, gin.H{"error": "Validation failed: " + err.Error()})
+		return
+	}
 
 	// update (using the merged and validated 'newRelation')
 	err = db.UpdatePluginRelation(newRelation)
@@ -242,6 +255,11 @@ func CreatePluginRelation(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Validation failed: " + err.Error()})
 		return
 	}
+	if status, err := checkRelationPipeline(relationToCreate); err != nil {
+		log.Warn("Plugin relation pipeline check failed on create", "pipeline_id", relationToCreate.PipelineID, "error", err)
+		c.JSON(status, gin.H{"error": "Validation failed: " + err.Error()})
+		return
+	}
 
 	// Create in DB
 	createdRelation, err := db.CreatePluginRelation(relationToCreate)
@@ -255,10 +273,10 @@ func CreatePluginRelation(c *gin.Context) {
 	c.JSON(http.StatusCreated, createdRelation)
 }
 
-// GetDistributionByInstanceID retrieves all plugins and their relations for a given distribution instance ID
+// GetDistributionByInstanceID retrieves all plugins and pipelines and their relations for a given distribution instance ID
 //
 //	@Summary		Get distribution by instance ID
-//	@Description	Retrieve all plugins and their relations for a specific distribution instance
+//	@Description	Retrieve all plugins and pipelines and their relations for a specific distribution instance
 //	@Tags			Converter Service
 //	@Produce		json
 //	@Param			instance_id	path		string	true	"Distribution Instance ID"
@@ -279,10 +297,25 @@ func GetDistributionByInstanceID(c *gin.Context) {
 	distributionInfo := DistributionInfo{
 		InstanceID: instanceID,
 		Relations:  make([]PluginWithRelationDetails, 0),
+		Pipelines:  make([]PipelineWithRelationDetails, 0),
 	}
 
 	for _, rel := range relations {
-		plugin, err := db.GetPluginByID(rel.PluginID)
+		if rel.PipelineID != "" {
+			pipeline, err := db.GetPipelineByID(rel.PipelineID.String())
+			if err != nil {
+				log.Warn("Pipeline not found for relation", "pipeline_id", rel.PipelineID, "relation_id", rel.ID)
+				continue
+			}
+
+			distributionInfo.Pipelines = append(distributionInfo.Pipelines, PipelineWithRelationDetails{
+				Pipeline: pipeline,
+				Relation: rel,
+			})
+			continue
+		}
+
+		plugin, err := db.GetPluginByID(rel.PluginID.String())
 		if err != nil {
 			log.Warn("Plugin not found for relation", "plugin_id", rel.PluginID, "relation_id", rel.ID)
 			continue
@@ -294,10 +327,38 @@ func GetDistributionByInstanceID(c *gin.Context) {
 		})
 	}
 
-	log.Debug("GetDistributionByInstanceID request successful", "instance_id", instanceID, "count", len(distributionInfo.Relations))
+	log.Debug("GetDistributionByInstanceID request successful", "instance_id", instanceID, "count", len(distributionInfo.Relations), "pipelines", len(distributionInfo.Pipelines))
 	c.JSON(http.StatusOK, distributionInfo)
 }
 
+// checkRelationPipeline checks that the pipeline of the relation, if it points at one, exists and converts the input
+// format of the relation into its output format. It returns the HTTP status of the failure along with the error.
+func checkRelationPipeline(relation model.PluginRelation) (int, error) {
+	if relation.PipelineID == "" {
+		return http.StatusOK, nil
+	}
+	pipeline, err := db.GetPipelineByID(relation.PipelineID.String())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return http.StatusBadRequest, errors.New("no pipeline found with pipeline_id: " + relation.PipelineID.String())
+		}
+		return http.StatusInternalServerError, fmt.Errorf("error getting the pipeline: %w", err)
+	}
+	if len(pipeline.Steps) == 0 {
+		return http.StatusBadRequest, errors.New("pipeline " + pipeline.ID + " has no steps")
+	}
+	first, last := pipeline.Steps[0], pipeline.Steps[len(pipeline.Steps)-1]
+	if model.MediaType(relation.InputFormat) != model.MediaType(first.InputFormat) {
+		return http.StatusBadRequest, fmt.Errorf("the input format %s does not match the input format %s of the first step of pipeline %s",
+			relation.InputFormat, first.InputFormat, pipeline.ID)
+	}
+	if model.MediaType(relation.OutputFormat) != model.MediaType(last.OutputFormat) {
+		return http.StatusBadRequest, fmt.Errorf("the output format %s does not match the output format %s of the last step of pipeline %s",
+			relation.OutputFormat, last.OutputFormat, pipeline.ID)
+	}
+	return http.StatusOK, nil
+}
+
 // mergePluginRelationUpdate takes the update payload and the existing relation data,
 // returning a new Plugin struct representing the merged state.
 // Fields are updated only if the corresponding pointer in 'update' is not nil.
@@ -313,7 +374,10 @@ func mergePluginRelationUpdate(update PluginRelationUpdate, old model.PluginRela
 		merged.OutputFormat = *update.OutputFormat
 	}
 	if update.PluginID != nil {
-		merged.PluginID = *update.PluginID
+		merged.PluginID = model.NullableID(*update.PluginID)
+	}
+	if update.PipelineID != nil {
+		merged.PipelineID = model.NullableID(*update.PipelineID)
 	}
 	if update.RelationID != nil {
 		merged.RelationID = *update.RelationID
@@ -2,15 +2,25 @@ package server
 
 import (
 	_ "embed"
+	"errors"
 	"log/slog"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/epos-eu/converter-service/logging"
-	"github.com/epos-eu/converter-service/rabbit"
+	"github.com/epos-eu/converter-service/metrics"
 	"github.com/epos-eu/converter-service/server/routes"
+	"github.com/epos-eu/converter-service/tracing"
+	"github.com/epos-eu/converter-service/transport"
 	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 //go:embed openapi.json
@@ -30,17 +40,25 @@ func slogGinMiddleware() gin.HandlerFunc {
 
 		c.Next()
 
-		if strings.Contains(path, "actuator/health") {
+		latency := time.Since(start)
+		status := c.Writer.Status()
+		// the route, not the path, so that the ids in the paths don't end up in the labels
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, strconv.Itoa(status)).Inc()
+		metrics.HTTPRequestDuration.WithLabelValues(c.Request.Method, route).Observe(latency.Seconds())
+
+		if strings.Contains(path, "actuator/health") || path == "/metrics" {
 			return
 		}
 
-		latency := time.Since(start)
 		clientIP := c.ClientIP()
 		if raw != "" {
 			path = path + "?" + raw
 		}
 
-		status := c.Writer.Status()
 		var level slog.Level
 		switch {
 		case status >= 500:
@@ -72,6 +90,38 @@ func slogGinMiddleware() gin.HandlerFunc {
 	}
 }
 
+// tracingMiddleware starts the span of each request, continuing the trace of the traceparent header of the request
+func tracingMiddleware() gin.HandlerFunc {
+	tracer := tracing.Tracer("server")
+
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if strings.Contains(path, "actuator/health") || path == "/metrics" {
+			c.Next()
+			return
+		}
+
+		ctx := otel.GetTextMapPropagator().Extract(c.Request.Context(), propagation.HeaderCarrier(c.Request.Header))
+		ctx, span := tracer.Start(ctx, c.Request.Method+" "+c.FullPath(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", c.Request.Method),
+				attribute.String("http.route", c.FullPath()),
+				attribute.String("url.path", path),
+			))
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		status := c.Writer.Status()
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
+	}
+}
+
 // customRecoveryMiddleware handles panics with structured logging
 func customRecoveryMiddleware() gin.HandlerFunc {
 	recoveryLog := logging.Get("recovery")
@@ -87,9 +137,9 @@ func customRecoveryMiddleware() gin.HandlerFunc {
 	})
 }
 
-// StartServer initializes the Gin engine and starts listening on :8080.
-// The RabbitMQ connection is passed for health checks.
-func StartServer(broker *rabbit.BrokerConfig) {
+// StartServer initializes the Gin engine and starts listening on :8080 in the background, the returned server is
+// shut down with Shutdown. The transport of the messages is passed for health checks.
+func StartServer(t transport.Transport) *http.Server {
 	gin.SetMode(gin.ReleaseMode)
 	gin.DisableConsoleColor()
 
@@ -99,6 +149,11 @@ func StartServer(broker *rabbit.BrokerConfig) {
 
 	r.Use(slogGinMiddleware())
 
+	r.Use(tracingMiddleware())
+
+	// Prometheus metrics
+	r.GET("/metrics", gin.WrapH(promhttp.Handler()))
+
 	// Routes
 	v1 := r.Group("/api/converter-service/v1")
 	{
@@ -117,6 +172,22 @@ func StartServer(broker *rabbit.BrokerConfig) {
 		v1.DELETE("/plugin-relations/distribution/:relation_id", routes.DeleteRelationsByDistributionID)
 		v1.DELETE("/plugin-relations/:relation_id", routes.DeletePluginRelation)
 
+		// Pipeline CRUD endpoints
+		v1.POST("/pipelines", routes.CreatePipeline)
+		v1.GET("/pipelines", routes.GetAllPipelines)
+		v1.GET("/pipelines/:pipeline_id", routes.GetPipeline)
+		v1.PUT("/pipelines/:pipeline_id", routes.UpdatePipeline)
+		v1.DELETE("/pipelines/:pipeline_id", routes.DeletePipeline)
+
+		// Conversion endpoint
+		v1.POST("/convert", routes.Convert)
+
+		// Asynchronous conversion jobs
+		v1.POST("/jobs", routes.CreateJob)
+		v1.GET("/jobs/:job_id", routes.GetJob)
+		v1.GET("/jobs/:job_id/result", routes.GetJobResult)
+		v1.DELETE("/jobs/:job_id", routes.DeleteJob)
+
 		// Distribution endpoints
 		v1.GET("/distributions/:instance_id", routes.GetDistributionByInstanceID)
 
@@ -124,9 +195,24 @@ func StartServer(broker *rabbit.BrokerConfig) {
 		v1.POST("/plugins/:plugin_id/enable", routes.EnablePlugin)
 		v1.POST("/plugins/:plugin_id/disable", routes.DisablePlugin)
 
+		// Test a plugin on a sample payload
+		v1.POST("/plugins/:plugin_id/test", routes.TestPlugin)
+
+		// Golden-file fixtures of the plugins
+		v1.GET("/plugins/:plugin_id/fixtures", routes.GetFixtures)
+		v1.POST("/plugins/:plugin_id/fixtures", routes.CreateFixture)
+		v1.POST("/plugins/:plugin_id/fixtures/run", routes.RunPluginFixtures)
+		v1.GET("/plugins/:plugin_id/fixtures/:fixture_id", routes.GetFixture)
+		v1.PUT("/plugins/:plugin_id/fixtures/:fixture_id", routes.UpdateFixture)
+		v1.DELETE("/plugins/:plugin_id/fixtures/:fixture_id", routes.DeleteFixture)
+		v1.POST("/fixtures/run", routes.RunAllFixtures)
+
+		// Execution history of the plugins
+		v1.GET("/executions", routes.GetExecutions)
+
 		// Health check
 		healthHandler := routes.HealthHandler{
-			Broker: broker,
+			Transport: t,
 		}
 		v1.GET("/actuator/health", healthHandler.Health)
 
@@ -141,9 +227,16 @@ func StartServer(broker *rabbit.BrokerConfig) {
 	//	@version	1.0
 	//	@BasePath	/api/converter-service/v1
 
-	err := r.Run(":8080")
-	if err != nil {
-		log.Error("failed to start server", slog.Any("error", err))
-		panic(err)
+	srv := &http.Server{
+		Addr:    ":8080",
+		Handler: r,
 	}
+	go func() {
+		err := srv.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error("failed to start server", slog.Any("error", err))
+			panic(err)
+		}
+	}()
+	return srv
 }
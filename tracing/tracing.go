@@ -0,0 +1,134 @@
+// Package tracing sets up the OpenTelemetry tracing of the service. The trace context is propagated with the W3C
+// traceparent and tracestate headers, in the headers of the AMQP messages and of the HTTP requests.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/epos-eu/converter-service/internal/env"
+	"github.com/epos-eu/converter-service/logging"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "converter-service"
+
+var (
+	log = logging.Get("tracing")
+
+	provider *sdktrace.TracerProvider
+	// the file the spans are written to by the file exporter
+	traceFile *os.File
+)
+
+// Tracer returns the tracer of a package of the service
+func Tracer(pkg string) trace.Tracer {
+	return otel.Tracer("github.com/epos-eu/converter-service/" + pkg)
+}
+
+// Init sets up the propagation of the trace context and the exporter of the spans. TRACING_EXPORTER chooses the
+// exporter: otlp (configured with the OTEL_EXPORTER_OTLP_* variables), stdout, file (TRACING_FILE) or none. It defaults
+// to otlp when an OTLP endpoint is set, to file when TRACING_FILE is set, and to none otherwise. Without an exporter
+// the spans are not recorded, but the trace context of the messages is still propagated to the replies and plugins.
+func Init(ctx context.Context) error {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	exporterName := env.Get("TRACING_EXPORTER", defaultExporter())
+	exporter, err := newExporter(ctx, exporterName)
+	if err != nil {
+		return fmt.Errorf("error creating the %s trace exporter: %w", exporterName, err)
+	}
+	if exporter == nil {
+		log.Info("tracing disabled, the trace context is only propagated")
+		return nil
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", serviceName)),
+		resource.WithFromEnv(),
+		resource.WithHost(),
+	)
+	if err != nil {
+		return fmt.Errorf("error creating the trace resource: %w", err)
+	}
+
+	// the sampler is configured with OTEL_TRACES_SAMPLER, the parent decides by default
+	provider = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	log.Info("tracing enabled", "exporter", exporterName)
+	return nil
+}
+
+func defaultExporter() string {
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != "" {
+		return "otlp"
+	}
+	if os.Getenv("TRACING_FILE") != "" {
+		return "file"
+	}
+	return "none"
+}
+
+// newExporter returns the exporter of the spans, nil for none
+func newExporter(ctx context.Context, name string) (sdktrace.SpanExporter, error) {
+	switch name {
+	case "otlp":
+		return otlptracehttp.New(ctx)
+	case "stdout":
+		return stdouttrace.New()
+	case "file":
+		path := env.Get("TRACING_FILE", "traces.json")
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("error opening the trace file: %w", err)
+		}
+		traceFile = file
+		return stdouttrace.New(stdouttrace.WithWriter(file))
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown exporter %q, expected otlp, stdout, file or none", name)
+	}
+}
+
+// Shutdown exports the spans left and stops the exporter
+func Shutdown(ctx context.Context) error {
+	var err error
+	if provider != nil {
+		err = provider.Shutdown(ctx)
+	}
+	if traceFile != nil {
+		err = errors.Join(err, traceFile.Close())
+	}
+	return err
+}
+
+// Traceparent returns the W3C traceparent of the span of ctx, empty if ctx has no valid span
+func Traceparent(ctx context.Context) string {
+	carrier := propagation.MapCarrier{}
+	propagation.TraceContext{}.Inject(ctx, carrier)
+	return carrier.Get("traceparent")
+}
+
+// End records err on the span if it is set, and ends the span
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,214 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"sync"
+)
+
+// the number of messages a queue of the Memory transport holds before Publish blocks
+const memoryQueueSize = 1024
+
+// Result is the outcome of a message handled by the Memory transport
+type Result struct {
+	Queue         string `json:"queue"`
+	CorrelationID string `json:"correlationId"`
+	// the reply of the message, empty if it was not replied to
+	Reply json.RawMessage `json:"reply,omitempty"`
+	// whether the message was acknowledged, or dropped
+	Acked bool `json:"acked"`
+}
+
+// Memory is an in-process transport. The messages are published with Publish, and the outcome of each one is given
+// to the result callback once it is settled.
+type Memory struct {
+	handlers    Handlers
+	onResult    func(Result)
+	concurrency int
+	queues      map[string]chan *memoryMessage
+
+	stopping chan struct{}
+	stopOnce sync.Once
+	// the running workers
+	running sync.WaitGroup
+	// the messages published and not settled yet
+	pending sync.WaitGroup
+}
+
+var _ Transport = (*Memory)(nil)
+
+// NewMemory returns a Memory transport handling the messages of each queue with its handler, concurrency at a time.
+// onResult is called by the workers, concurrently.
+func NewMemory(handlers Handlers, concurrency int, onResult func(Result)) *Memory {
+	m := &Memory{
+		handlers:    handlers,
+		onResult:    onResult,
+		concurrency: max(concurrency, 1),
+		queues:      map[string]chan *memoryMessage{},
+		stopping:    make(chan struct{}),
+	}
+	for queue := range handlers {
+		m.queues[queue] = make(chan *memoryMessage, memoryQueueSize)
+	}
+	return m
+}
+
+// Start starts the workers of the queues, they run until Shutdown
+func (m *Memory) Start(_ context.Context) error {
+	for queue, handle := range m.handlers {
+		for range m.concurrency {
+			m.running.Add(1)
+			go func() {
+				defer m.running.Done()
+				for {
+					select {
+					case msg := <-m.queues[queue]:
+						Handle(context.Background(), msg, handle)
+					case <-m.stopping:
+						return
+					}
+				}
+			}()
+		}
+	}
+	return nil
+}
+
+// Shutdown stops the workers once the messages they are handling are settled, the messages still queued are dropped
+func (m *Memory) Shutdown(ctx context.Context) error {
+	m.stopOnce.Do(func() { close(m.stopping) })
+	stopped := make(chan struct{})
+	go func() {
+		m.running.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("workers still running: %w", ctx.Err())
+	}
+}
+
+// Health always returns nil, the Memory transport can't be disconnected
+func (m *Memory) Health() error {
+	return nil
+}
+
+// Publish queues a message
+func (m *Memory) Publish(ctx context.Context, queue, correlationID string, body []byte) error {
+	q, ok := m.queues[queue]
+	if !ok {
+		return fmt.Errorf("unknown queue %s", queue)
+	}
+	msg := &memoryMessage{m: m, queue: queue, correlationID: correlationID, body: body}
+	m.pending.Add(1)
+	select {
+	case q <- msg:
+		return nil
+	case <-ctx.Done():
+		m.pending.Done()
+		return ctx.Err()
+	}
+}
+
+// PublishLines publishes each non-empty line read from r as a message, their correlation ids are the line numbers
+func (m *Memory) PublishLines(ctx context.Context, queue string, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		body := slices.Clone(scanner.Bytes())
+		if err := m.Publish(ctx, queue, strconv.Itoa(line), body); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading the messages: %w", err)
+	}
+	return nil
+}
+
+// PublishDir publishes each file of dir as a message, by name order, their correlation ids are the names of the files
+func (m *Memory) PublishDir(ctx context.Context, queue, dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("error reading the messages directory: %w", err)
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		body, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("error reading message %s: %w", entry.Name(), err)
+		}
+		if err := m.Publish(ctx, queue, entry.Name(), body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Wait waits until all the messages published are settled
+func (m *Memory) Wait() {
+	m.pending.Wait()
+}
+
+// memoryMessage is the Message of the Memory transport
+type memoryMessage struct {
+	m             *Memory
+	queue         string
+	correlationID string
+	body          []byte
+	reply         []byte
+}
+
+func (msg *memoryMessage) Body() []byte {
+	return msg.body
+}
+
+func (msg *memoryMessage) CorrelationID() string {
+	return msg.correlationID
+}
+
+func (msg *memoryMessage) Reply(_ context.Context, body []byte) error {
+	msg.reply = body
+	return nil
+}
+
+func (msg *memoryMessage) Ack() error {
+	msg.settle(true)
+	return nil
+}
+
+func (msg *memoryMessage) Nack(requeue bool) error {
+	if !requeue {
+		msg.settle(false)
+		return nil
+	}
+	msg.reply = nil
+	select {
+	case msg.m.queues[msg.queue] <- msg:
+		return nil
+	default:
+		msg.settle(false)
+		return fmt.Errorf("queue %s is full, message dropped", msg.queue)
+	}
+}
+
+func (msg *memoryMessage) settle(acked bool) {
+	defer msg.m.pending.Done()
+	if msg.m.onResult != nil {
+		msg.m.onResult(Result{Queue: msg.queue, CorrelationID: msg.correlationID, Reply: msg.reply, Acked: acked})
+	}
+}
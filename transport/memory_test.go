@@ -0,0 +1,229 @@
+package transport_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/epos-eu/converter-service/dao/model"
+	"github.com/epos-eu/converter-service/handler"
+	"github.com/epos-eu/converter-service/transport"
+	"gorm.io/gorm"
+)
+
+// catalogue is a handler.Store holding a fixed set of plugins and relations
+type catalogue struct {
+	plugins   map[string]model.Plugin
+	relations []model.PluginRelation
+
+	mu         sync.Mutex
+	executions []model.Execution
+}
+
+func (c *catalogue) GetPluginByID(pluginID string) (model.Plugin, error) {
+	plugin, ok := c.plugins[pluginID]
+	if !ok {
+		return plugin, gorm.ErrRecordNotFound
+	}
+	return plugin, nil
+}
+
+func (c *catalogue) GetPipelineByID(string) (model.Pipeline, error) {
+	return model.Pipeline{}, gorm.ErrRecordNotFound
+}
+
+func (c *catalogue) GetEnabledPluginRelationsByRelationID(distributionID string) ([]model.PluginRelation, error) {
+	var relations []model.PluginRelation
+	for _, relation := range c.relations {
+		plugin := c.plugins[relation.PluginID.String()]
+		if relation.RelationID == distributionID && plugin.Enabled && plugin.Installed {
+			relations = append(relations, relation)
+		}
+	}
+	return relations, nil
+}
+
+func (c *catalogue) GetPluginRelationForEnabledPlugins() ([]model.PluginRelation, error) {
+	var relations []model.PluginRelation
+	for _, relation := range c.relations {
+		if plugin := c.plugins[relation.PluginID.String()]; plugin.Enabled && plugin.Installed {
+			relations = append(relations, relation)
+		}
+	}
+	return relations, nil
+}
+
+func (c *catalogue) GetPipelineRelations() ([]model.PluginRelation, error) {
+	return nil, nil
+}
+
+func (c *catalogue) GetFixturesByPluginID(string) ([]model.PluginFixture, error) {
+	return nil, nil
+}
+
+func (c *catalogue) EnablePlugin(pluginID string, enable bool) error {
+	plugin, ok := c.plugins[pluginID]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	plugin.Enabled = enable
+	c.plugins[pluginID] = plugin
+	return nil
+}
+
+func (c *catalogue) CreateExecution(execution model.Execution) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.executions = append(c.executions, execution)
+	return nil
+}
+
+// installPlugin writes a shell script plugin in ./plugins/<id>
+func installPlugin(t *testing.T, id, script string) model.Plugin {
+	t.Helper()
+	dir := filepath.Join("plugins", id)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "convert.sh"), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	return model.Plugin{
+		ID:         id,
+		Name:       id,
+		Version:    "main",
+		Runtime:    model.SupportedRuntimesBinary,
+		Executable: "convert.sh",
+		Installed:  true,
+		Enabled:    true,
+		Protocol:   model.ProtocolOneshot,
+	}
+}
+
+func TestMemoryMessageFlow(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	store := &catalogue{
+		plugins: map[string]model.Plugin{
+			"wrap": installPlugin(t, "wrap", `printf '{"converted": %s}' "$(cat "$1")" > "$2"`),
+			"fail": installPlugin(t, "fail", `echo "unsupported payload" >&2; exit 3`),
+		},
+		relations: []model.PluginRelation{
+			{ID: "r1", PluginID: "wrap", RelationID: "dist-wrap", InputFormat: "application/json", OutputFormat: "application/epos.geo+json"},
+			{ID: "r2", PluginID: "fail", RelationID: "dist-fail", InputFormat: "application/json", OutputFormat: "application/epos.geo+json"},
+		},
+	}
+	previous := handler.UseStore(store)
+	t.Cleanup(func() { handler.UseStore(previous) })
+
+	var mu sync.Mutex
+	results := map[string]transport.Result{}
+	memory := transport.NewMemory(transport.DefaultHandlers(), 2, func(result transport.Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		results[result.CorrelationID] = result
+	})
+	ctx := t.Context()
+	if err := memory.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := memory.Shutdown(shutdownCtx); err != nil {
+			t.Error(err)
+		}
+	})
+
+	conversion := func(distributionID, payload string) []byte {
+		body, err := json.Marshal(handler.Message{
+			Parameters: handler.Parameters{DistributionID: distributionID, ResponseFormat: "application/epos.geo+json"},
+			Payload:    payload,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return body
+	}
+	messages := []struct {
+		queue, correlationID string
+		body                 []byte
+	}{
+		{transport.QueueMap, "converted", conversion("dist-wrap", `{"a": 1}`)},
+		{transport.QueueMap, "failed", conversion("dist-fail", `{"a": 1}`)},
+		{transport.QueueMap, "unknown", conversion("dist-unknown", `{"a": 1}`)},
+		{transport.QueueMap, "invalid", []byte("not json")},
+		{transport.QueueResources, "resources", []byte(`{"plugins": "all"}`)},
+	}
+	for _, msg := range messages {
+		if err := memory.Publish(ctx, msg.queue, msg.correlationID, msg.body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	memory.Wait()
+
+	for _, msg := range messages {
+		if !results[msg.correlationID].Acked {
+			t.Errorf("message %s was not acknowledged", msg.correlationID)
+		}
+	}
+
+	var converted handler.Response
+	if err := json.Unmarshal(results["converted"].Reply, &converted); err != nil {
+		t.Fatalf("invalid reply %s: %v", results["converted"].Reply, err)
+	}
+	if inner, _ := converted.Payload["converted"].(map[string]any); inner["a"] != 1.0 {
+		t.Errorf("unexpected converted content %s", results["converted"].Reply)
+	}
+
+	for correlationID, code := range map[string]handler.ErrorCode{
+		"failed":  handler.CodePluginFailed,
+		"unknown": handler.CodePluginNotFound,
+		"invalid": handler.CodeBadMessage,
+	} {
+		var reply handler.ErrorReply
+		if err := json.Unmarshal(results[correlationID].Reply, &reply); err != nil {
+			t.Fatalf("invalid error reply of %s %s: %v", correlationID, results[correlationID].Reply, err)
+		}
+		if reply.Error.Code != code {
+			t.Errorf("message %s: got error code %s, want %s", correlationID, reply.Error.Code, code)
+		}
+	}
+	var failed handler.ErrorReply
+	_ = json.Unmarshal(results["failed"].Reply, &failed)
+	if failed.Error.PluginID != "fail" || failed.Error.Stderr != "unsupported payload" {
+		t.Errorf("unexpected error reply of the failed plugin %s", results["failed"].Reply)
+	}
+
+	var resources []struct {
+		DistributionID string `json:"distributionId"`
+		Relations      []struct {
+			PluginID string `json:"pluginId"`
+		} `json:"relations"`
+	}
+	if err := json.Unmarshal(results["resources"].Reply, &resources); err != nil {
+		t.Fatalf("invalid resources reply %s: %v", results["resources"].Reply, err)
+	}
+	if len(resources) != 2 {
+		t.Errorf("got %d distributions in the resources reply, want 2", len(resources))
+	}
+
+	// the executions of the plugins are in the history, with the message they come from
+	outcomes := map[string]model.Execution{}
+	for _, execution := range store.executions {
+		outcomes[execution.CorrelationID] = execution
+	}
+	if len(store.executions) != 2 {
+		t.Fatalf("got %d executions recorded, want 2", len(store.executions))
+	}
+	if execution := outcomes["converted"]; execution.Outcome != model.ExecutionSucceeded || execution.PluginID != "wrap" || execution.DistributionID != "dist-wrap" {
+		t.Errorf("unexpected execution of the converted message %+v", execution)
+	}
+	if execution := outcomes["failed"]; execution.Outcome != model.ExecutionFailed || execution.ErrorCode != string(handler.CodePluginFailed) {
+		t.Errorf("unexpected execution of the failed message %+v", execution)
+	}
+}
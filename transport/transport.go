@@ -0,0 +1,147 @@
+// Package transport is how the messages get to the handlers and how their replies get back to the callers. The AMQP
+// transport is in the rabbit package, Memory runs the whole message flow in process.
+package transport
+
+import (
+	"context"
+	"errors"
+
+	"github.com/epos-eu/converter-service/handler"
+	"github.com/epos-eu/converter-service/logging"
+)
+
+var log = logging.Get("transport")
+
+// the queues consumed by the service
+const (
+	// the conversion requests, handled by handler.ExternalAccessHandler
+	QueueMap = "map"
+	// the resources queries, handled by handler.ResourcesServiceHandler
+	QueueResources = "resources"
+)
+
+// Handler handles the body of a message and returns the body of its reply
+type Handler func(context.Context, []byte) ([]byte, error)
+
+// Handlers is the handler of each queue
+type Handlers map[string]Handler
+
+// DefaultHandlers returns the handlers of the queues of the service
+func DefaultHandlers() Handlers {
+	return Handlers{
+		QueueMap:       handler.ExternalAccessHandler,
+		QueueResources: handler.ResourcesServiceHandler,
+	}
+}
+
+// Transport receives the messages of the queues and hands them to the handlers
+type Transport interface {
+	// Start starts consuming the queues, the transport keeps running until ctx is done
+	Start(ctx context.Context) error
+	// Shutdown stops consuming the queues and waits for the messages being handled until ctx is done
+	Shutdown(ctx context.Context) error
+	// Health returns an error when the transport can't receive or reply to messages
+	Health() error
+}
+
+// Message is a message received from a transport. A message is settled once, by Ack or Nack.
+type Message interface {
+	Body() []byte
+	CorrelationID() string
+	// Reply sends the reply of the message to its caller
+	Reply(ctx context.Context, body []byte) error
+	Ack() error
+	// Nack settles a message that could not be handled, the transport delivers it again if requeue is set
+	Nack(requeue bool) error
+}
+
+// RetryOutcome is what happened to a failed message
+type RetryOutcome int
+
+const (
+	// the error is terminal, the message was left untouched
+	Terminal RetryOutcome = iota
+	// the message will be retried, it was settled
+	RetryScheduled
+	// the message is out of retries and was parked, it still has to be acknowledged
+	Parked
+)
+
+// Retrier is implemented by the messages of the transports that can retry a failed message later
+type Retrier interface {
+	// Retry schedules a new attempt of the message, that failed with an error of the class (an handler.ErrorCode,
+	// ErrorPublishFailed or ErrorReplyUnroutable)
+	Retry(class string, cause error) RetryOutcome
+}
+
+// ErrorPublishFailed is the error class of the replies that could not be sent
+const ErrorPublishFailed = "publish_failed"
+
+// ErrorReplyUnroutable is the error class of the replies that could not be routed to any queue, they are not retried
+// unless the class is made retryable
+const ErrorReplyUnroutable = "reply_unroutable"
+
+// ErrUnroutable is returned by Reply when no queue is bound to the routing key of the reply
+var ErrUnroutable = errors.New("the message could not be routed")
+
+// Handle runs the message through the handler, replies with its response, or with an error reply if it failed, then
+// acknowledges the message. Messages are retried when their transport supports it. ctx carries the trace context of
+// the message.
+func Handle(ctx context.Context, msg Message, handle Handler) {
+	ctx = handler.WithCorrelationID(ctx, msg.CorrelationID())
+	retrier, canRetry := msg.(Retrier)
+
+	resp, err := handle(ctx, msg.Body())
+	if err != nil {
+		// reply with the error so that the caller doesn't wait until its own timeout
+		reply := handler.NewErrorReply(err)
+		log.Error("handler failed", "error", err, "code", reply.Error.Code, "plugin_id", reply.Error.PluginID, "correlation_id", msg.CorrelationID())
+		if canRetry && retrier.Retry(string(reply.Error.Code), err) == RetryScheduled {
+			return
+		}
+		resp, err = reply.Marshal()
+		if err != nil {
+			log.Error("error creating the error reply", "error", err)
+			nack(msg)
+			return
+		}
+	} else {
+		log.Debug("message handled successfully")
+	}
+
+	if err = msg.Reply(ctx, resp); err != nil {
+		log.Error("publish failed", "error", err)
+		class := ErrorPublishFailed
+		if errors.Is(err, ErrUnroutable) {
+			class = ErrorReplyUnroutable
+		}
+		outcome := Terminal
+		if canRetry {
+			outcome = retrier.Retry(class, err)
+		}
+		switch outcome {
+		case RetryScheduled:
+			return
+		case Terminal:
+			nack(msg)
+			return
+		case Parked:
+			// acknowledged below, the message is parked
+		}
+	} else {
+		log.Debug("message sent successfully")
+	}
+
+	if err = msg.Ack(); err != nil {
+		log.Error("ack failed", "error", err)
+		return
+	}
+	log.Debug("message acknowledged successfully")
+}
+
+// nack drops the message, it is not requeued as it would fail again
+func nack(msg Message) {
+	if err := msg.Nack(false); err != nil {
+		log.Error("error nack-ing", "error", err)
+	}
+}